@@ -0,0 +1,371 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Garik-/humanize/pkg/database"
+	"github.com/Garik-/humanize/pkg/drummap"
+	"github.com/Garik-/humanize/pkg/ranges"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var errArgs = errors.New("wrong number of arguments")
+
+// checkKey rejects keys the database cannot have, a note number in a database
+// keyed on articulations is left to the user.
+func checkKey(db *database.Database, key string) error {
+	if key == "" {
+		return errors.New("empty key")
+	}
+	if anchor, member, ok := database.SplitChordKey(key); ok {
+		if err := checkKey(db, anchor); err != nil {
+			return err
+		}
+		return checkKey(db, member)
+	}
+	if !db.Articulations() {
+		if _, ok := database.ParseNoteKey(key); !ok {
+			return fmt.Errorf("%q is not a note, the database is keyed on notes", key)
+		}
+	}
+	return nil
+}
+
+// parseValues reads velocities, 0-127, for the timing tables offsets in
+// ticks and for the hand velocity table distances from the mean of a run,
+// which may be negative, and for the length table lengths in ticks of up to
+// four bars.
+func parseValues(msgType uint8, s string) ([]int, error) {
+	list, err := ranges.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+
+	min, max := 0, 127
+	switch msgType {
+	case database.Timing, database.HandTiming:
+		min, max = -database.TimingResolution, database.TimingResolution
+	case database.HandVelocity:
+		min, max = -127, 127
+	case database.Length:
+		min, max = 1, 16*database.TimingResolution
+	}
+
+	var values []int
+	for _, r := range list {
+		if r.Min < min || r.Max > max || r.Min > r.Max {
+			return nil, fmt.Errorf("bad values %q, must be within %d-%d", s, min, max)
+		}
+		for v := r.Min; v <= r.Max; v++ {
+			values = append(values, v)
+		}
+	}
+	return values, nil
+}
+
+// formatValues writes a value seen more than once with its number of
+// samples, "90x3".
+func formatValues(h database.Histogram) string {
+	values := h.Values()
+	s := make([]string, len(values))
+	for i, v := range values {
+		s[i] = strconv.Itoa(v)
+		if h[v] > 1 {
+			s[i] += "x" + strconv.Itoa(h[v])
+		}
+	}
+	return strings.Join(s, " ")
+}
+
+func list(db *database.Database, args []string) (*database.Database, error) {
+	if len(args) != 0 {
+		return nil, errArgs
+	}
+	msgTypes, err := tables()
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("keys: %s\n", db.Keys)
+	for _, msgType := range msgTypes {
+		table := db.Table(msgType)
+		for _, key := range table.Keys() {
+			values, samples := 0, 0
+			for _, h := range table[key] {
+				values += len(h.Values())
+				samples += h.Samples()
+			}
+			fmt.Printf("%-10s %-24s %3d positions %5d values %7d samples\n", tableName(msgType), key, len(table[key]), values, samples)
+		}
+	}
+	return db, nil
+}
+
+func show(db *database.Database, args []string) (*database.Database, error) {
+	if len(args) != 1 {
+		return nil, errArgs
+	}
+	msgTypes, err := tables()
+	if err != nil {
+		return nil, err
+	}
+
+	key, found := args[0], false
+	for _, msgType := range msgTypes {
+		positions, ok := db.Table(msgType)[key]
+		if !ok {
+			continue
+		}
+		found = true
+
+		fmt.Printf("%s %s\n", tableName(msgType), key)
+		for _, position := range positions.Sorted() {
+			fmt.Printf("  %4d: %s\n", position, formatValues(positions[position]))
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("no key %q", key)
+	}
+	return db, nil
+}
+
+func set(db *database.Database, args []string) (*database.Database, error) {
+	if len(args) != 3 {
+		return nil, errArgs
+	}
+	if *tableFlag == "" {
+		*tableFlag = "noteOn"
+	}
+	msgTypes, err := tables()
+	if err != nil {
+		return nil, err
+	}
+
+	key := args[0]
+	if err = checkKey(db, key); err != nil {
+		return nil, err
+	}
+	position, err := strconv.Atoi(args[1])
+	if err != nil {
+		return nil, fmt.Errorf("bad position %q", args[1])
+	}
+	values, err := parseValues(msgTypes[0], args[2])
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return nil, errors.New("no values, use delete to remove a position")
+	}
+
+	db.Set(msgTypes[0], key, position, values)
+	return db, nil
+}
+
+func remove(db *database.Database, args []string) (*database.Database, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return nil, errArgs
+	}
+	msgTypes, err := tables()
+	if err != nil {
+		return nil, err
+	}
+
+	key, position, all := args[0], 0, len(args) == 1
+	if !all {
+		if position, err = strconv.Atoi(args[1]); err != nil {
+			return nil, fmt.Errorf("bad position %q", args[1])
+		}
+	}
+
+	found := false
+	for _, msgType := range msgTypes {
+		table := db.Table(msgType)
+		positions, ok := table[key]
+		if !ok {
+			continue
+		}
+
+		if all {
+			delete(table, key)
+			found = true
+			continue
+		}
+		if _, ok := positions[position]; ok {
+			delete(positions, position)
+			if len(positions) == 0 {
+				delete(table, key)
+			}
+			found = true
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("no key %q", strings.Join(args, " "))
+	}
+	return db, nil
+}
+
+func rename(db *database.Database, args []string) (*database.Database, error) {
+	if len(args) != 2 {
+		return nil, errArgs
+	}
+	msgTypes, err := tables()
+	if err != nil {
+		return nil, err
+	}
+	if err = checkKey(db, args[1]); err != nil {
+		return nil, err
+	}
+	_, _, fromChord := database.SplitChordKey(args[0])
+	_, _, toChord := database.SplitChordKey(args[1])
+	if fromChord != toChord {
+		return nil, fmt.Errorf("cannot rename %q to %q", args[0], args[1])
+	}
+
+	found := false
+	for _, msgType := range msgTypes {
+		if db.Table(msgType).Rename(args[0], args[1]) {
+			found = true
+		}
+		if msgType == database.Chord && !fromChord && renameChords(db.Table(msgType), args[0], args[1]) {
+			found = true
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("no key %q", args[0])
+	}
+	return db, nil
+}
+
+// renameChords renames a key where it is the anchor or the member of a chord
+// key.
+func renameChords(table database.Table, from string, to string) bool {
+	found := false
+	for _, key := range table.Keys() {
+		anchor, member, ok := database.SplitChordKey(key)
+		if !ok || (anchor != from && member != from) {
+			continue
+		}
+		if anchor == from {
+			anchor = to
+		}
+		if member == from {
+			member = to
+		}
+		table.Rename(key, database.ChordKey(anchor, member))
+		found = true
+	}
+	return found
+}
+
+// convert rewrites every key through the drum map. Notes the map has no
+// articulation for are dropped, articulations it has no note for fall back to
+// the closest one of the same instrument.
+func convert(db *database.Database, args []string) (*database.Database, error) {
+	if len(args) != 1 {
+		return nil, errArgs
+	}
+	to := args[0]
+	if to != database.KeyNotes && to != database.KeyArticulations {
+		return nil, fmt.Errorf("cannot convert to %q, use notes or articulations", to)
+	}
+
+	m, err := drummap.Load(*drumMapFlag)
+	if err != nil {
+		return nil, err
+	}
+
+	converted := database.New()
+	converted.Keys = to
+
+	for _, t := range tableNames {
+		msgType, table := t.msgType, db.Table(t.msgType)
+		for _, key := range table.Keys() {
+			positions := table[key]
+			newKey, ok := convertKey(db, m, to, key)
+			if !ok {
+				fmt.Fprintf(os.Stderr, "drop %s %s: not in drum map %s\n", t.name, key, m.Name)
+				continue
+			}
+
+			for position, h := range positions {
+				for value, n := range h {
+					converted.AddSamples(msgType, newKey, position, value, n)
+				}
+			}
+		}
+	}
+
+	return converted, nil
+}
+
+func convertKey(db *database.Database, m *drummap.Map, to string, key string) (string, bool) {
+	if db.Articulations() == (to == database.KeyArticulations) {
+		return key, true
+	}
+
+	if anchor, member, ok := database.SplitChordKey(key); ok {
+		if anchor, ok = convertKey(db, m, to, anchor); !ok {
+			return "", false
+		}
+		if member, ok = convertKey(db, m, to, member); !ok {
+			return "", false
+		}
+		return database.ChordKey(anchor, member), true
+	}
+
+	if to == database.KeyArticulations {
+		note, ok := database.ParseNoteKey(key)
+		if !ok {
+			return "", false
+		}
+		a, ok := m.Articulation(note)
+		return string(a), ok
+	}
+
+	note, ok := m.Note(drummap.Articulation(key))
+	return database.NoteKey(note), ok
+}
+
+func prune(db *database.Database, args []string) (*database.Database, error) {
+	if len(args) != 0 {
+		return nil, errArgs
+	}
+	if *minSamplesFlag <= 0 && *percentileFlag <= 0 {
+		return nil, errors.New("nothing to prune, set -min-samples or -percentile")
+	}
+	if *percentileFlag < 0 || *percentileFlag >= 50 {
+		return nil, fmt.Errorf("bad percentile %g, must be within 0-50", *percentileFlag)
+	}
+
+	r := db.Prune(database.PruneOptions{
+		MinSamples: *minSamplesFlag,
+		Merge:      *mergeFlag,
+		Percentile: *percentileFlag,
+	})
+
+	for _, e := range r.Dropped {
+		fmt.Printf("drop  %-10s %-24s %4d: %d samples\n", tableName(e.MsgType), e.Key, e.Position, e.Samples)
+	}
+	for _, e := range r.Merged {
+		fmt.Printf("merge %-10s %-24s %4d: %d samples into %d\n", tableName(e.MsgType), e.Key, e.Position, e.Samples, *e.Into)
+	}
+
+	fmt.Printf("%-8s %8s %8s\n", "", "before", "after")
+	fmt.Printf("%-8s %8d %8d\n", "keys", r.Before.Keys, r.After.Keys)
+	fmt.Printf("%-8s %8d %8d\n", "entries", r.Before.Entries, r.After.Entries)
+	fmt.Printf("%-8s %8d %8d\n", "values", r.Before.Values, r.After.Values)
+	fmt.Printf("%-8s %8d %8d\n", "samples", r.Before.Samples, r.After.Samples)
+	if r.Outliers > 0 {
+		fmt.Printf("outliers: %d samples\n", r.Outliers)
+	}
+
+	if *reportFlag != "" {
+		if err := writeJSON(*reportFlag, r); err != nil {
+			return nil, err
+		}
+	}
+
+	return db, nil
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/Garik-/humanize/pkg/database"
+	"log"
+	"os"
+)
+
+// command is a subcommand, run gets the arguments left after its flags.
+type command struct {
+	name  string
+	args  string
+	usage string
+	edits bool // writes the database back
+	run   func(db *database.Database, args []string) (*database.Database, error)
+}
+
+var commands = []*command{
+	{name: "list", usage: "List the keys of the tables", run: list},
+	{name: "show", args: "key", usage: "Print the values of a key by position", run: show},
+	{name: "set", args: "key position values", usage: "Replace the values of a key at a position, e.g. set snare.center 0 60-72,80", edits: true, run: set},
+	{name: "delete", args: "key [position]", usage: "Delete a key or one position of it", edits: true, run: remove},
+	{name: "rename", args: "key new-key", usage: "Rename a key, also within chord keys, values of positions both keys have are merged", edits: true, run: rename},
+	{name: "prune", usage: "Drop or merge entries with fewer than -min-samples samples and remove outliers by -percentile", edits: true, run: prune},
+	{name: "convert", args: "notes|articulations", usage: "Key the database on notes or on articulation names of the -map drum map", edits: true, run: convert},
+}
+
+var (
+	flags = flag.NewFlagSet("dbtool", flag.ExitOnError)
+
+	databaseFlag = flags.String("d", "", "The path to the database json file")
+	outFlag      = flags.String("o", "", "The path the edited database is written to, defaults to -d")
+	tableFlag    = flags.String("table", "", "Only this table: noteOn, noteOff, aftertouch, timing, length,\ntransition, transition2, crossTransition, handVelocity, handTiming or chord, set uses noteOn by default")
+	drumMapFlag  = flags.String("map", "gm", "The drum map articulation names are converted with, a built-in map (gm, sd3, ezd2, ad2, ssd5) or a json file")
+
+	minSamplesFlag = flags.Int("min-samples", 0, "prune: entries, the values of a key at a position, with fewer samples are dropped")
+	mergeFlag      = flags.Bool("merge", false, "prune: merge sparse entries into the nearest position of the key instead of dropping them")
+	percentileFlag = flags.Float64("percentile", 0, "prune: remove the values of an entry below this percentile and above 100 minus it")
+	reportFlag     = flags.String("report", "", "prune: the path to the json report of the dropped and merged entries")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s command [flags] [arguments]\n\nCommands:\n", os.Args[0])
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-8s %-22s %s\n", c.name, c.args, c.usage)
+	}
+	fmt.Fprintf(os.Stderr, "\nFlags:\n")
+	flags.PrintDefaults()
+}
+
+func findCommand(name string) *command {
+	for _, c := range commands {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func readDatabase(name string) (*database.Database, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return database.Load(f)
+}
+
+func writeJSON(name string, v interface{}) error {
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	encoder := json.NewEncoder(f)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+func main() {
+	flags.Usage = usage
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	c := findCommand(os.Args[1])
+	if c == nil {
+		usage()
+		os.Exit(2)
+	}
+
+	if err := flags.Parse(os.Args[2:]); err != nil {
+		log.Fatal(err)
+	}
+	if *databaseFlag == "" {
+		usage()
+		os.Exit(2)
+	}
+
+	db, err := readDatabase(*databaseFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	db, err = c.run(db, flags.Args())
+	if err != nil {
+		log.Fatalf("%s: %s", c.name, err)
+	}
+
+	if !c.edits {
+		return
+	}
+
+	out := *outFlag
+	if out == "" {
+		out = *databaseFlag
+	}
+	if err = db.WriteFile(out); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// tableNames are the json names of the tables in the order they are printed.
+var tableNames = []struct {
+	name    string
+	msgType uint8
+}{
+	{"noteOn", database.NoteOn},
+	{"noteOff", database.NoteOff},
+	{"aftertouch", database.Aftertouch},
+	{"timing", database.Timing},
+	{"length", database.Length},
+	{"transition", database.Transition},
+	{"transition2", database.Transition2},
+	{"crossTransition", database.CrossTransition},
+	{"handVelocity", database.HandVelocity},
+	{"handTiming", database.HandTiming},
+	{"chord", database.Chord},
+}
+
+// tables returns the message types -table selects, all of them by default.
+func tables() ([]uint8, error) {
+	var msgTypes []uint8
+	for _, t := range tableNames {
+		if *tableFlag == "" || *tableFlag == t.name {
+			msgTypes = append(msgTypes, t.msgType)
+		}
+	}
+	if len(msgTypes) == 0 {
+		return nil, fmt.Errorf("unknown table %q", *tableFlag)
+	}
+	return msgTypes, nil
+}
+
+func tableName(msgType uint8) string {
+	for _, t := range tableNames {
+		if t.msgType == msgType {
+			return t.name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"github.com/Garik-/humanize/pkg/database"
+	"github.com/Garik-/humanize/pkg/drummap"
+	"github.com/Garik-/humanize/pkg/midi"
+)
+
+// chordKey returns the key of the chord table for a note played with an
+// anchor note, the articulations of both fall back to their parents.
+func (l *lookup) chordKey(table database.Table, anchor uint8, member uint8) (string, bool) {
+	if !l.articulations {
+		a, ok := l.note(anchor)
+		if !ok {
+			return "", false
+		}
+		m, ok := l.note(member)
+		return database.ChordKey(database.NoteKey(a), database.NoteKey(m)), ok
+	}
+
+	a, ok := l.articulation(anchor)
+	if !ok {
+		return "", false
+	}
+	m, ok := l.articulation(member)
+	if !ok {
+		return "", false
+	}
+	for ; a != drummap.Articulation(""); a = a.Parent() {
+		for p := m; p != drummap.Articulation(""); p = p.Parent() {
+			if key := database.ChordKey(string(a), string(p)); table[key] != nil {
+				return key, true
+			}
+		}
+	}
+	return "", false
+}
+
+// chord returns the velocities of a note played with an anchor note at the
+// velocity.
+func (l *lookup) chord(anchor uint8, member uint8, velocity uint8) ([]int, bool) {
+	table, ok := l.tables[database.Chord]
+	if !ok {
+		return nil, false
+	}
+	key, ok := l.chordKey(table, anchor, member)
+	if !ok {
+		return nil, false
+	}
+	return table.Lookup(key, database.VelocityBin(int(velocity)))
+}
+
+// chordPlan holds the chords of the track being planned, the loudest hit of
+// a chord is its anchor and the others take velocities that go with the one
+// the anchor was given.
+type chordPlan struct {
+	anchors    map[*midi.Event]*midi.Event // the anchor of each other hit of a chord
+	velocities map[*midi.Event]uint8       // the velocities given to the anchors, the input ones until they are planned
+}
+
+// orderChords finds the chords of a track and returns its events with the
+// anchor of each chord moved before the other hits of it, so every hit is
+// sampled once and after its anchor.
+func (h *humanizer) orderChords(events []*midi.Event, ticksPerQuarterNote uint16) ([]*midi.Event, *chordPlan) {
+	c := &chordPlan{
+		anchors:    make(map[*midi.Event]*midi.Event),
+		velocities: make(map[*midi.Event]uint8),
+	}
+
+	window := h.chordWindow * int64(ticksPerQuarterNote) / database.TimingResolution
+
+	// the hits of a chord by its first hit, the anchor first
+	chords := make(map[*midi.Event][]*midi.Event)
+	for _, group := range midi.Simultaneous(events, window) {
+		anchor := group[0]
+		for _, e := range group[1:] {
+			if e.Velocity > anchor.Velocity {
+				anchor = e
+			}
+		}
+
+		c.velocities[anchor] = anchor.Velocity
+		hits := []*midi.Event{anchor}
+		for _, e := range group {
+			if e != anchor {
+				c.anchors[e] = anchor
+				hits = append(hits, e)
+			}
+		}
+		chords[group[0]] = hits
+	}
+
+	// the anchor may not be the first hit of its chord, it is placed with the
+	// first one and skipped at its own place
+	placed := make(map[*midi.Event]bool)
+	ordered := make([]*midi.Event, 0, len(events))
+	for _, e := range events {
+		if placed[e] {
+			continue
+		}
+		if hits, ok := chords[e]; ok {
+			for _, hit := range hits {
+				placed[hit] = true
+			}
+			ordered = append(ordered, hits...)
+			continue
+		}
+		ordered = append(ordered, e)
+	}
+
+	return ordered, c
+}
+
+// give records the velocity an event was given, the other hits of its chord
+// follow it when it is an anchor.
+func (c *chordPlan) give(event *midi.Event, velocity uint8) {
+	if c == nil {
+		return
+	}
+	if _, ok := c.velocities[event]; ok {
+		c.velocities[event] = velocity
+	}
+}
+
+// chordValues returns the velocities of the chord table for a hit played with
+// the anchor of its chord, nil when it is not part of a chord, is an anchor
+// or the table has nothing for it.
+func (h *humanizer) chordValues(track int, event *midi.Event, c *chordPlan) []int {
+	if c == nil || event.MsgType != database.NoteOn {
+		return nil
+	}
+
+	anchor, ok := c.anchors[event]
+	if !ok {
+		return nil
+	}
+	velocity := c.velocities[anchor]
+
+	values, ok := h.data.chord(anchor.Note, event.Note, velocity)
+	if !ok {
+		return nil
+	}
+	h.report.addNote(database.Chord, track, event, database.VelocityBin(int(velocity)), levelExact)
+	return values
+}
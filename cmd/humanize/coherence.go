@@ -0,0 +1,47 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+)
+
+// instrument is what a hit follows the previous hit of, the family of its
+// note when the drum maps know it, so closed and open hi-hat hits follow each
+// other, or else the note.
+type instrument struct {
+	track   int
+	msgType uint8
+	name    string
+}
+
+// walks keeps the correlated noise of each instrument, a value of the standard
+// normal distribution that a hit takes over from the previous one by the
+// coherence of the note. The noise is turned into a quantile of the values of
+// the entry, so a coherent take still draws from the learned distribution.
+type walks map[instrument]float64
+
+// next moves the noise of the instrument on by one hit and returns its
+// quantile, 0-1.
+func (w walks) next(rng *rand.Rand, i instrument, coherence float64) float64 {
+	z, ok := w[i]
+	if ok {
+		z = coherence*z + math.Sqrt(1-coherence*coherence)*rng.NormFloat64()
+	} else {
+		z = rng.NormFloat64()
+	}
+	w[i] = z
+
+	return 0.5 * (1 + math.Erf(z/math.Sqrt2))
+}
+
+// quantileIndex returns the index of the quantile u of n sorted values.
+func quantileIndex(u float64, n int) int {
+	i := int(u * float64(n))
+	if i >= n {
+		i = n - 1
+	}
+	if i < 0 {
+		i = 0
+	}
+	return i
+}
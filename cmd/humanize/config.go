@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Garik-/humanize/pkg/database"
+	"github.com/Garik-/humanize/pkg/drummap"
+	"os"
+)
+
+// noteConfig overrides the flags for some notes, fields left out keep the
+// value of the flag.
+type noteConfig struct {
+	Enabled   *bool    `json:"enabled"`
+	Min       *int     `json:"min"`
+	Max       *int     `json:"max"`
+	Range     *string  `json:"range"`
+	Knee      *float64 `json:"knee"`
+	Strength  *int     `json:"strength"`
+	Coherence *int     `json:"coherence"`
+}
+
+// config is the -config file. Its keys are note numbers of the input file or
+// articulation names, "hihat" applies to every hi-hat articulation that has
+// no entry of its own and a note number goes before any name.
+type config struct {
+	Notes map[string]*noteConfig `json:"notes"`
+}
+
+// settings is what applies to a note once the config and the flags are
+// combined.
+type settings struct {
+	enabled   bool
+	vr        *velocityRange
+	strength  float64 // 0-1
+	coherence float64 // 0-1, how much a velocity follows the previous hit of the instrument
+}
+
+func readConfig(name string) (*config, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var c config
+	decoder := json.NewDecoder(f)
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(&c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (nc *noteConfig) apply(defaults *settings) (*settings, error) {
+	s := *defaults
+
+	if nc.Enabled != nil {
+		s.enabled = *nc.Enabled
+	}
+
+	mode, min, max, knee := s.vr.mode, s.vr.min, s.vr.max, s.vr.knee
+	if nc.Range != nil {
+		mode = *nc.Range
+	}
+	if nc.Min != nil {
+		min = *nc.Min
+	}
+	if nc.Max != nil {
+		max = *nc.Max
+	}
+	if nc.Knee != nil {
+		knee = *nc.Knee
+	}
+
+	var err error
+	if s.vr, err = newVelocityRange(mode, min, max, knee); err != nil {
+		return nil, err
+	}
+
+	if nc.Strength != nil {
+		if *nc.Strength < 0 || *nc.Strength > 100 {
+			return nil, fmt.Errorf("strength %d must be within 0-100", *nc.Strength)
+		}
+		s.strength = float64(*nc.Strength) / 100
+	}
+
+	if nc.Coherence != nil {
+		if *nc.Coherence < 0 || *nc.Coherence > 100 {
+			return nil, fmt.Errorf("coherence %d must be within 0-100", *nc.Coherence)
+		}
+		s.coherence = float64(*nc.Coherence) / 100
+	}
+
+	return &s, nil
+}
+
+// noteSettings resolves the settings of the notes of the input file.
+type noteSettings struct {
+	config   *config
+	defaults *settings
+	data     *lookup
+	byNote   map[uint8]*settings
+}
+
+// newNoteSettings checks every entry of the config against the flags, so a
+// mistake shows before the first note needs the entry.
+func newNoteSettings(c *config, defaults *settings, data *lookup) (*noteSettings, error) {
+	if c != nil {
+		for key, nc := range c.Notes {
+			if nc == nil {
+				return nil, fmt.Errorf("%s: empty entry", key)
+			}
+			if _, err := nc.apply(defaults); err != nil {
+				return nil, fmt.Errorf("%s: %s", key, err)
+			}
+		}
+	}
+
+	return &noteSettings{config: c, defaults: defaults, data: data, byNote: make(map[uint8]*settings)}, nil
+}
+
+// entry finds the config of a note, by its number first and then by its
+// articulation and the parents of it.
+func (ns *noteSettings) entry(note uint8) *noteConfig {
+	if ns.config == nil {
+		return nil
+	}
+	if nc, ok := ns.config.Notes[database.NoteKey(note)]; ok {
+		return nc
+	}
+
+	a, ok := ns.data.articulation(note)
+	if !ok {
+		return nil
+	}
+	for ; a != drummap.Articulation(""); a = a.Parent() {
+		if nc, ok := ns.config.Notes[string(a)]; ok {
+			return nc
+		}
+	}
+	return nil
+}
+
+func (ns *noteSettings) get(note uint8) *settings {
+	if s, ok := ns.byNote[note]; ok {
+		return s
+	}
+
+	s := ns.defaults
+	if nc := ns.entry(note); nc != nil {
+		// newNoteSettings has checked the entry
+		s, _ = nc.apply(ns.defaults)
+	}
+
+	ns.byNote[note] = s
+	return s
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"github.com/Garik-/humanize/pkg/database"
+	"strings"
+)
+
+// Levels of the fallback chain, an event gets the values of the first level
+// that has any.
+const (
+	levelExact   = "exact"   // the key at the position of the event
+	levelNearest = "nearest" // the key at the closest positions that have values, any position of a bar
+	levelBeat    = "beat"    // the key at the positions of the same beat class, on or off beat
+	levelNote    = "note"    // the key at all positions pooled
+	levelSibling = "sibling" // the keys under the parent of the articulation, at the position or at any
+	levelFamily  = "family"  // the keys of the same instrument, at the position or at any
+	levelGlobal  = "global"  // every key, at the position or at any
+	levelNone    = "none"    // nothing found, the event is left as it is
+)
+
+// defaultFallback stays within the key and the other ways to play the same
+// sound, "hihat.closed.tip" for "hihat.closed.edge". The values of the rest
+// of the keys are opt-in: a note the database has never seen is left as it
+// is.
+const defaultFallback = levelNearest + "," + levelSibling
+
+// beat and note only serve events when they come before nearest, which finds
+// values whenever the key has any.
+var levels = []string{levelExact, levelNearest, levelBeat, levelNote, levelSibling, levelFamily, levelGlobal}
+
+// parseFallback returns the chain of levels, the exact position always comes
+// first and "none" turns the fallback off.
+func parseFallback(s string) ([]string, error) {
+	chain := []string{levelExact}
+
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" || part == levelNone || part == levelExact {
+			continue
+		}
+
+		known := false
+		for _, l := range levels {
+			known = known || l == part
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown fallback level %q, use %s", part, strings.Join(levels[1:], ", "))
+		}
+
+		for _, l := range chain {
+			if l == part {
+				return nil, fmt.Errorf("fallback level %q is given twice", part)
+			}
+		}
+		chain = append(chain, part)
+	}
+
+	return chain, nil
+}
+
+// pool merges the values of the positions matched by the function into one
+// sorted distinct list.
+func pool(positions database.Positions, match func(position int) bool) []int {
+	merged := make(database.Histogram)
+	for position, h := range positions {
+		if match(position) {
+			merged.Merge(h)
+		}
+	}
+	return merged.Values()
+}
+
+func anyPosition(int) bool { return true }
+
+func nearest(positions database.Positions, position int) []int {
+	closest := 0
+	for p, v := range positions {
+		if d := database.PositionDistance(p, position); d > 0 && len(v) > 0 && (closest == 0 || d < closest) {
+			closest = d
+		}
+	}
+	if closest == 0 {
+		return nil
+	}
+	return pool(positions, func(p int) bool { return database.PositionDistance(p, position) == closest })
+}
+
+func sameBeat(positions database.Positions, position int) []int {
+	return pool(positions, func(p int) bool {
+		d := database.PositionDistance(p, position)
+		return d > 0 && d%2 == 0
+	})
+}
+
+// poolKeys merges the values of several keys at the position, or at any
+// position when none of them has values there.
+func poolKeys(table database.Table, keys []string, position int) []int {
+	merged := make(database.Positions)
+	for _, key := range keys {
+		for p, h := range table[key] {
+			if _, ok := merged[p]; !ok {
+				merged[p] = make(database.Histogram)
+			}
+			merged[p].Merge(h)
+		}
+	}
+
+	if values := pool(merged, func(p int) bool { return p == position }); len(values) > 0 {
+		return values
+	}
+	return pool(merged, anyPosition)
+}
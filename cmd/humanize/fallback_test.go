@@ -0,0 +1,57 @@
+package main
+
+import (
+	"github.com/Garik-/humanize/pkg/database"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestParseFallback(t *testing.T) {
+	chain, err := parseFallback(defaultFallback)
+	require.NoError(t, err)
+	assert.Equal(t, []string{levelExact, levelNearest, levelSibling}, chain)
+
+	chain, err = parseFallback("nearest,family,global")
+	require.NoError(t, err)
+	assert.Equal(t, []string{levelExact, levelNearest, levelFamily, levelGlobal}, chain)
+
+	chain, err = parseFallback(levelNone)
+	require.NoError(t, err)
+	assert.Equal(t, []string{levelExact}, chain)
+
+	chain, err = parseFallback("beat,note,nearest")
+	require.NoError(t, err)
+	assert.Equal(t, []string{levelExact, levelBeat, levelNote, levelNearest}, chain)
+
+	_, err = parseFallback("bar")
+	assert.Error(t, err)
+	_, err = parseFallback("family,family")
+	assert.Error(t, err)
+}
+
+func TestNearest(t *testing.T) {
+	positions := database.Positions{
+		2: {100: 1},
+		3: {80: 1},
+	}
+
+	// position 3 is one position away from 0 across the bar line
+	assert.Equal(t, []int{80}, nearest(positions, 0))
+	assert.Equal(t, []int{100}, nearest(positions, 1))
+	assert.Equal(t, []int{80, 100}, nearest(database.Positions{0: {100: 1}, 2: {80: 1}}, 1))
+	assert.Nil(t, nearest(database.Positions{1: {90: 1}}, 1))
+}
+
+func TestSameBeat(t *testing.T) {
+	positions := database.Positions{
+		0: {100: 1},
+		1: {60: 1},
+		2: {90: 1},
+		3: {50: 1},
+	}
+
+	assert.Equal(t, []int{90}, sameBeat(positions, 0))
+	assert.Equal(t, []int{50}, sameBeat(positions, 1))
+	assert.Empty(t, sameBeat(database.Positions{1: {60: 1}}, 0))
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"github.com/Garik-/humanize/pkg/database"
+	"github.com/Garik-/humanize/pkg/midi"
+	"github.com/Garik-/humanize/pkg/sticking"
+	"math"
+)
+
+// assignHands finds the runs of hi-hat and ride hits in the selected tracks
+// and the hand that plays each hit of them.
+func (h *humanizer) assignHands(decoder *midi.Decoder) {
+	type instrument struct {
+		channel uint8
+		family  string
+	}
+
+	for i, track := range decoder.Tracks {
+		if !h.selector.track(i, track) {
+			continue
+		}
+
+		hits := make(map[instrument][]*midi.Event)
+		for _, event := range track.Events {
+			if event.MsgType != database.NoteOn || event.Velocity == 0 {
+				continue
+			}
+			if a := h.data.noteArticulation(event.Note); sticking.Played(a) {
+				k := instrument{event.Channel, a.Family()}
+				hits[k] = append(hits[k], event)
+			}
+		}
+
+		for _, events := range hits {
+			ticks := make([]int64, len(events))
+			for n, event := range events {
+				ticks[n] = event.AbsTicks
+			}
+			for n, hand := range sticking.Hands(ticks, decoder.TicksPerQuarterNote) {
+				if hand != sticking.None {
+					h.hands[events[n]] = hand
+				}
+			}
+		}
+	}
+}
+
+// applyHands moves the planned velocities of the hits played by a hand by a
+// distance from the mean of a run sampled for that hand, by the strength of
+// the note and within its range.
+func (h *humanizer) applyHands(plans []*planned) {
+	for _, p := range plans {
+		hand, ok := h.hands[p.event]
+		if !ok || p.event.MsgType != database.NoteOn {
+			continue
+		}
+
+		offsets, ok := h.data.exact(database.HandVelocity, p.event.Note, int(hand))
+		if !ok {
+			continue
+		}
+		h.report.addNote(database.HandVelocity, p.track, p.event, int(hand), hand.String())
+
+		s := h.settings.get(p.event.Note)
+		offset := float64(offsets[h.rng.Intn(len(offsets))]) * s.strength
+		v := math.Round(float64(p.velocity) + offset)
+		v = math.Max(math.Max(1, float64(s.vr.min)), math.Min(float64(s.vr.max), v))
+		p.velocity = uint8(v)
+	}
+}
+
+// handOffsets returns the timing offsets of the hand that plays a note, false
+// when it is not played by a hand or the database has none for it.
+func (h *humanizer) handOffsets(track int, on *midi.Event) ([]int, bool) {
+	hand, ok := h.hands[on]
+	if !ok {
+		return nil, false
+	}
+
+	offsets, ok := h.data.exact(database.HandTiming, on.Note, int(hand))
+	if ok {
+		h.report.addNote(database.HandTiming, track, on, int(hand), hand.String())
+	}
+	return offsets, ok
+}
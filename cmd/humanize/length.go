@@ -0,0 +1,56 @@
+package main
+
+import (
+	"github.com/Garik-/humanize/pkg/database"
+	"github.com/Garik-/humanize/pkg/midi"
+	"math"
+)
+
+// length samples a length for a note from the length table and blends it with
+// the length of the input by the strength of the note, in ticks of the file.
+func (h *humanizer) length(track int, n *midi.Note, ticksPerQuarterNote uint16) (int64, bool) {
+	on := n.On
+	s := h.settings.get(on.Note)
+	if !h.selector.event(on) || !s.enabled {
+		return 0, false
+	}
+
+	lengths, level := h.data.find(database.Length, on.Note, on.QuarterPosition)
+	h.report.addNote(database.Length, track, on, on.QuarterPosition, level)
+	if level == levelNone {
+		return 0, false
+	}
+
+	input := float64(n.Off.AbsTicks - on.AbsTicks)
+	sampled := float64(lengths[h.rng.Intn(len(lengths))]) * float64(ticksPerQuarterNote) / database.TimingResolution
+
+	return int64(math.Round(input + (sampled-input)*s.strength)), true
+}
+
+// resizeTrack moves the ends of the notes of a track to the sampled lengths.
+// A note keeps at least one tick and ends before the next note of its key
+// starts, notes that already overlap it in the input are left as they are.
+func (h *humanizer) resizeTrack(track int, notes []*midi.Note, ticksPerQuarterNote uint16) {
+	nextOn := nextOfKey(notes)
+
+	for i, n := range notes {
+		if n.Off == nil || nextOn[i] < n.Off.AbsTicks {
+			continue
+		}
+
+		length, ok := h.length(track, n, ticksPerQuarterNote)
+		if !ok {
+			continue
+		}
+
+		max := int64(math.MaxInt64)
+		if nextOn[i] != math.MaxInt64 {
+			max = nextOn[i] - n.On.AbsTicks
+		}
+		if max < 1 {
+			continue
+		}
+
+		n.Off.AbsTicks = n.On.AbsTicks + clamp(length, 1, max)
+	}
+}
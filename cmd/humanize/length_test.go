@@ -0,0 +1,68 @@
+package main
+
+import (
+	"github.com/Garik-/humanize/pkg/database"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestResizeTrack(t *testing.T) {
+	cases := []struct {
+		name    string
+		lengths map[string]int
+		notes   []testNote
+		want    []testNote
+	}{
+		{
+			"sampled length",
+			map[string]int{"36": 200},
+			[]testNote{{36, 480, 540}},
+			[]testNote{{36, 480, 680}},
+		},
+		{
+			"at least one tick",
+			map[string]int{"36": 0},
+			[]testNote{{36, 480, 540}},
+			[]testNote{{36, 480, 481}},
+		},
+		{
+			"same-tick group",
+			map[string]int{"36": 100, "38": 300},
+			[]testNote{{36, 480, 540}, {38, 480, 540}, {42, 480, 540}},
+			[]testNote{{36, 480, 580}, {38, 480, 780}, {42, 480, 540}},
+		},
+		{
+			"ends before the next note of its key",
+			map[string]int{"36": 200},
+			[]testNote{{36, 480, 540}, {36, 600, 660}},
+			[]testNote{{36, 480, 600}, {36, 600, 800}},
+		},
+		{
+			"overlapping input",
+			map[string]int{"36": 200},
+			[]testNote{{36, 480, 900}, {36, 720, 1000}},
+			[]testNote{{36, 480, 900}, {36, 720, 920}},
+		},
+		{
+			"zero length",
+			map[string]int{"36": 200},
+			[]testNote{{36, 480, 480}, {36, 720, 780}},
+			[]testNote{{36, 480, 680}, {36, 720, 920}},
+		},
+		{
+			"next of key on the same tick",
+			map[string]int{"36": 200},
+			[]testNote{{36, 480, 540}, {36, 480, 600}},
+			[]testNote{{36, 480, 540}, {36, 480, 680}},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			h := newTableHumanizer(t, database.Length, c.lengths, 0)
+			notes := newTestNotes(c.notes)
+			h.resizeTrack(0, notes, testTicksPerQuarterNote)
+			assert.Equal(t, c.want, testNotesOf(notes))
+		})
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"github.com/Garik-/humanize/pkg/database"
+	"github.com/Garik-/humanize/pkg/drummap"
+	"github.com/Garik-/humanize/pkg/midi"
+)
+
+// lookup finds the database values for the events of the input file.
+type lookup struct {
+	tables        map[uint8]database.Table
+	drumMap       *drummap.Map     // the input file is mapped to, nil uses notes as they are
+	dbMap         *drummap.Map     // the database was written in
+	articulations bool             // the database is keyed on articulation names
+	chain         []string         // fallback levels, levelExact first
+	pools         map[string][]int // family and global values, they are the same for many events
+}
+
+// note translates a note of the input file to the database.
+func (l *lookup) note(note uint8) (uint8, bool) {
+	if l.drumMap == nil {
+		return note, true
+	}
+	return drummap.Translate(l.drumMap, l.dbMap, note)
+}
+
+// articulation names the note of the input file, the input file is read with
+// its own drum map or with the one of the database.
+func (l *lookup) articulation(note uint8) (drummap.Articulation, bool) {
+	m := l.drumMap
+	if m == nil {
+		m = l.dbMap
+	}
+	return m.Articulation(note)
+}
+
+// key returns the key of the note in the table. An articulation the database
+// has no entry for falls back to the closest parent it has, "hihat.closed.tip"
+// to "hihat.closed".
+func (l *lookup) key(table database.Table, note uint8) (string, bool) {
+	if !l.articulations {
+		note, ok := l.note(note)
+		return database.NoteKey(note), ok
+	}
+
+	a, ok := l.articulation(note)
+	if !ok {
+		return "", false
+	}
+	for ; a != ""; a = a.Parent() {
+		if _, ok := table[string(a)]; ok {
+			return string(a), true
+		}
+	}
+	return "", false
+}
+
+// rewrites reports whether events of the message type are looked up.
+func (l *lookup) rewrites(msgType uint8) bool {
+	_, ok := l.tables[msgType]
+	return ok
+}
+
+// noteArticulation names a note of the input file, "" if the drum maps do
+// not know it.
+func (l *lookup) noteArticulation(note uint8) drummap.Articulation {
+	if !l.articulations {
+		var ok bool
+		if note, ok = l.note(note); !ok {
+			return ""
+		}
+		a, _ := l.dbMap.Articulation(note)
+		return a
+	}
+
+	a, _ := l.articulation(note)
+	return a
+}
+
+// family returns the instrument of a note of the input file, "" if the drum
+// maps do not know it.
+func (l *lookup) family(note uint8) string {
+	return l.noteArticulation(note).Family()
+}
+
+// sibling returns the parent of the articulation of a note of the input file
+// whose keys the sibling level pools, "hihat.closed" for "hihat.closed.edge".
+// It is "" when the parent is the instrument itself, that is the family level.
+func (l *lookup) sibling(note uint8) drummap.Articulation {
+	a := l.noteArticulation(note)
+	parent := a.Parent()
+	if parent == "" || string(parent) == a.Family() {
+		return ""
+	}
+	return parent
+}
+
+// keyArticulation names a database key.
+func (l *lookup) keyArticulation(key string) drummap.Articulation {
+	if l.articulations {
+		return drummap.Articulation(key)
+	}
+	note, ok := database.ParseNoteKey(key)
+	if !ok {
+		return ""
+	}
+	a, _ := l.dbMap.Articulation(note)
+	return a
+}
+
+// keyFamily returns the instrument of a database key.
+func (l *lookup) keyFamily(key string) string {
+	return l.keyArticulation(key).Family()
+}
+
+// values returns the values for the event and the level of the fallback
+// chain they were found at.
+func (l *lookup) values(event *midi.Event) ([]int, string) {
+	return l.find(event.MsgType, event.Note, event.QuarterPosition)
+}
+
+// find walks the fallback chain of the table for a note of the input file.
+func (l *lookup) find(msgType uint8, note uint8, position int) ([]int, string) {
+	table, ok := l.tables[msgType]
+	if !ok {
+		return nil, levelNone
+	}
+
+	key, hasKey := l.key(table, note)
+
+	for _, level := range l.chain {
+		var values []int
+
+		switch level {
+		case levelExact:
+			if hasKey {
+				values, _ = table.Lookup(key, position)
+			}
+		case levelNearest:
+			if hasKey {
+				values = nearest(table[key], position)
+			}
+		case levelBeat:
+			if hasKey {
+				values = sameBeat(table[key], position)
+			}
+		case levelNote:
+			if hasKey {
+				values = pool(table[key], anyPosition)
+			}
+		case levelSibling:
+			if parent := l.sibling(note); parent != "" {
+				values = l.pooled(msgType, levelSibling+":"+string(parent), position, func(k string) bool {
+					return l.keyArticulation(k).Within(parent)
+				})
+			}
+		case levelFamily:
+			if family := l.family(note); family != "" {
+				values = l.pooled(msgType, family, position, func(k string) bool {
+					return l.keyFamily(k) == family
+				})
+			}
+		case levelGlobal:
+			values = l.pooled(msgType, "", position, func(string) bool { return true })
+		}
+
+		if len(values) > 0 {
+			return values, level
+		}
+	}
+
+	return nil, levelNone
+}
+
+// exact returns the values of a note at a position without the fallback
+// chain.
+func (l *lookup) exact(msgType uint8, note uint8, position int) ([]int, bool) {
+	table, ok := l.tables[msgType]
+	if !ok {
+		return nil, false
+	}
+	key, ok := l.key(table, note)
+	if !ok {
+		return nil, false
+	}
+	return table.Lookup(key, position)
+}
+
+// pooled merges the values of the keys matched by the function, the result is
+// kept for the next event of the same group of keys, a family or the siblings
+// of a parent, and position.
+func (l *lookup) pooled(msgType uint8, group string, position int, match func(key string) bool) []int {
+	id := fmt.Sprintf("%d/%s/%d", msgType, group, position)
+	if values, ok := l.pools[id]; ok {
+		return values
+	}
+
+	table := l.tables[msgType]
+	var keys []string
+	for _, k := range table.Keys() {
+		if match(k) {
+			keys = append(keys, k)
+		}
+	}
+
+	values := poolKeys(table, keys, position)
+	if l.pools == nil {
+		l.pools = make(map[string][]int)
+	}
+	l.pools[id] = values
+	return values
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"github.com/Garik-/humanize/pkg/database"
+	"github.com/Garik-/humanize/pkg/drummap"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestLookup_Key(t *testing.T) {
+	sd3, err := drummap.Load("sd3")
+	require.NoError(t, err)
+
+	l := &lookup{drumMap: sd3, dbMap: sd3, articulations: true}
+
+	cases := []struct {
+		name  string
+		table database.Table
+		note  uint8
+		key   string
+		ok    bool
+	}{
+		{"exact", database.Table{"hihat.closed.edge": {}, "hihat.closed.tip": {}}, 22, "hihat.closed.edge", true},
+		{"parent", database.Table{"hihat.closed": {}, "hihat.closed.tip": {}}, 22, "hihat.closed", true},
+		{"grandparent", database.Table{"hihat": {}, "hihat.closed.tip": {}}, 22, "hihat", true},
+		{"sibling is not a key", database.Table{"hihat.closed.tip": {}, "snare.center": {}}, 22, "", false},
+		{"other instrument", database.Table{"snare.center": {}}, 22, "", false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			key, ok := l.key(c.table, c.note)
+			assert.Equal(t, c.ok, ok)
+			assert.Equal(t, c.key, key)
+		})
+	}
+}
+
+func TestLookup_Sibling(t *testing.T) {
+	sd3, err := drummap.Load("sd3")
+	require.NoError(t, err)
+
+	table := database.Table{
+		"hihat.closed.tip": {0: {70: 1}},
+		"hihat.pedal":      {0: {30: 1}},
+		"snare.center":     {0: {100: 1}, 1: {110: 1}},
+	}
+	chain := []string{levelExact, levelNearest, levelSibling, levelFamily}
+
+	cases := []struct {
+		name   string
+		note   uint8
+		values []int
+		level  string
+	}{
+		{"closed hi-hat edge", 22, []int{70}, levelSibling},
+		{"closed hi-hat tip", 42, []int{70}, levelExact},
+		{"open hi-hat, its parent is the instrument", 46, []int{30, 70}, levelFamily},
+		{"snare rimshot, its parent is the instrument", 40, []int{100}, levelFamily},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			l := &lookup{
+				tables:        map[uint8]database.Table{database.NoteOn: table},
+				drumMap:       sd3,
+				dbMap:         sd3,
+				articulations: true,
+				chain:         chain,
+			}
+			values, level := l.find(database.NoteOn, c.note, 0)
+			assert.Equal(t, c.level, level)
+			assert.Equal(t, c.values, values)
+		})
+	}
+}
@@ -2,12 +2,13 @@ package main
 
 import (
 	"encoding/binary"
-	"encoding/json"
 	"flag"
 	"fmt"
+	"github.com/Garik-/humanize/pkg/database"
+	"github.com/Garik-/humanize/pkg/drummap"
 	"github.com/Garik-/humanize/pkg/midi"
+	"github.com/Garik-/humanize/pkg/sticking"
 	"io"
-	"io/ioutil"
 	"log"
 	"math/rand"
 	"os"
@@ -20,38 +21,121 @@ var (
 	outFlag      = flag.String("o", "", "Output midi file")
 	minFlag      = flag.Int("min", 0, "Min velocity")
 	maxFlag      = flag.Int("max", 127, "Max velocity")
-)
+	rangeFlag    = flag.String("range", rangeReject, "How velocities are kept within -min and -max: reject, rescale, clamp or compress")
+	kneeFlag     = flag.Float64("knee", 10, "The width of the soft knee below -max and above -min in compress mode")
+
+	strengthFlag        = flag.Int("strength", 100, "How far velocities move from the input towards the sampled values, 0-100 percent")
+	coherenceFlag       = flag.Int("coherence", 0, "How much a velocity follows the previous hit of the same instrument, 0-100 percent,\n0 draws every hit on its own")
+	preserveAccentsFlag = flag.Bool("preserve-accents", false, "Keep the order of the input velocities of each note within a bar")
+
+	tracksFlag           = flag.String("tracks", "", "Only rewrite these tracks, indexes from 0 as in the report, e.g. 1-3")
+	excludeTracksFlag    = flag.String("exclude-tracks", "", "Leave these tracks alone")
+	trackNameFlag        = flag.String("track-name", "", "Only rewrite tracks whose name matches this regular expression")
+	excludeTrackNameFlag = flag.String("exclude-track-name", "", "Leave tracks whose name matches this regular expression alone")
+	channelFlag          = flag.String("channel", "", "Only rewrite these MIDI channels (1-16), e.g. 10")
+	excludeChannelFlag   = flag.String("exclude-channel", "", "Leave these MIDI channels alone")
+	notesFlag            = flag.String("notes", "", "Only rewrite these notes, e.g. 35-59")
+	excludeNotesFlag     = flag.String("exclude-notes", "", "Leave these notes alone, e.g. 44")
+
+	configFlag = flag.String("config", "", "The path to a json file with min, max, range, knee, strength, coherence and enabled\nfor single notes or articulations, the flags are the defaults")
+
+	drumMapFlag = flag.String("map", "", "The drum map of the input file, a built-in map (gm, sd3, ezd2, ad2, ssd5) or a json file")
+	dbMapFlag   = flag.String("db-map", "gm", "The drum map the database was written in,\nthe input file is read with it when the database is keyed on articulations and -map is not set")
+
+	noteOffFlag    = flag.Bool("note-off", false, "Also rewrite Note Off release velocities")
+	aftertouchFlag = flag.Bool("aftertouch", false, "Also rewrite polyphonic aftertouch pressure")
 
-// note -> type -> position -> velocity
-type velocityMap map[uint8]map[uint8]map[int][]int
+	fallbackFlag   = flag.String("fallback", defaultFallback, "Where values are looked for when the position of an event has none, in order:\nnearest, beat, note, sibling, family, global, or none")
+	minSamplesFlag = flag.Int("min-samples", 0, "Ignore database entries, the values of a key at a position, with fewer samples,\nthe fallback chain serves their events")
+	seedFlag       = flag.Int64("seed", 0, "The seed of the random numbers, the same seed, input, database and flags give the same output,\n0 picks a new seed, the seed used is printed")
+	reportFlag     = flag.String("report", "", "The path to the json report of the fallback level that served each event")
 
-func importDatabase(name string) (velocityMap, error) {
+	markovFlag      = flag.Int("markov", 0, "Draw Note On velocities from the transitions that follow the previous 1 or 2 hits of the note,\nhits whose context the database has not seen use their position, 0 turns it off")
+	markovCrossFlag = flag.Bool("markov-cross", false, "With -markov, first try the transitions that also follow the previous hit of any other note")
+
+	chordsFlag      = flag.Bool("chords", false, "Give hits played together velocities that go with the loudest hit of their group")
+	chordWindowFlag = flag.Int("chord-window", 20, "With -chords, hits that start within this many ticks at 480 per quarter note\nof the first one are played together")
+
+	handsFlag = flag.Bool("hands", false, "Give the hits of fast hi-hat and ride runs the velocity and, with -timing, the timing\nof the hand that plays them")
+
+	timingFlag   = flag.Bool("timing", false, "Also move note starts by offsets from the grid sampled from the timing table,\nthe output file is written anew instead of patched")
+	maxShiftFlag = flag.Int("max-shift", 30, "The most ticks at 480 per quarter note -timing moves a note")
+	lengthFlag   = flag.Bool("length", false, "Also change note lengths to lengths sampled from the length table,\nthe output file is written anew instead of patched")
+)
+
+func importDatabase(name string) (*database.Database, error) {
 	jsonFile, err := os.Open(name)
 	if err != nil {
 		return nil, err
 	}
 	defer jsonFile.Close()
 
-	var bytes []byte
-	bytes, err = ioutil.ReadAll(jsonFile)
+	return database.Load(jsonFile)
+}
+
+// newLookup uses the database tables of the message types to rewrite, Note On
+// velocities always and the others when asked for.
+func newLookup(db *database.Database) (*lookup, error) {
+	if *minSamplesFlag > 0 {
+		db.Prune(database.PruneOptions{MinSamples: *minSamplesFlag})
+	}
+
+	chain, err := parseFallback(*fallbackFlag)
 	if err != nil {
+		return nil, fmt.Errorf("-fallback: %s", err)
+	}
+
+	l := &lookup{
+		tables:        map[uint8]database.Table{database.NoteOn: db.NoteOn},
+		articulations: db.Articulations(),
+		chain:         chain,
+	}
+	if *noteOffFlag {
+		l.tables[database.NoteOff] = db.NoteOff
+	}
+	if *aftertouchFlag {
+		l.tables[database.Aftertouch] = db.Aftertouch
+	}
+	if *markovFlag > 0 {
+		l.tables[database.Transition] = db.Transition
+		l.tables[database.Transition2] = db.Transition2
+		l.tables[database.CrossTransition] = db.CrossTransition
+	}
+	if *chordsFlag {
+		l.tables[database.Chord] = db.Chord
+	}
+	if *handsFlag {
+		l.tables[database.HandVelocity] = db.HandVelocity
+		l.tables[database.HandTiming] = db.HandTiming
+	}
+	if *timingFlag {
+		l.tables[database.Timing] = db.Timing
+	}
+	if *lengthFlag {
+		l.tables[database.Length] = db.Length
+	}
+
+	if *drumMapFlag != "" {
+		if l.drumMap, err = drummap.Load(*drumMapFlag); err != nil {
+			return nil, err
+		}
+	}
+	// the family fallback names the notes of a database keyed on notes with it too
+	if l.dbMap, err = drummap.Load(*dbMapFlag); err != nil {
 		return nil, err
 	}
 
-	var data velocityMap
-	err = json.Unmarshal(bytes, &data)
-	return data, err
+	return l, nil
 }
 
-func randVelocity(velocities []int, def uint8, min int, max int) uint8 {
+func randVelocity(rng *rand.Rand, velocities []int, def uint8, min int, max int) uint8 {
 	attempts := len(velocities)
 	for {
 		if attempts == 0 {
 			return def
 		}
 
-		rand.Seed(time.Now().UTC().UnixNano())
-		velocity := velocities[rand.Intn(len(velocities))]
+		velocity := velocities[rng.Intn(len(velocities))]
 		if velocity > min && velocity < max {
 			return uint8(velocity)
 		} else {
@@ -60,36 +144,50 @@ func randVelocity(velocities []int, def uint8, min int, max int) uint8 {
 	}
 }
 
-func writeRandVelocity(w io.WriteSeeker, decoder *midi.Decoder, data velocityMap) error {
-	for _, track := range decoder.Tracks {
-		for _, event := range track.Events {
-			if event.Velocity == 0 {
-				continue
-			}
-			if msgType, ok := data[event.Note]; ok {
-				if positions, ok := msgType[event.MsgType]; ok {
-					if velocities, ok := positions[event.QuarterPosition]; ok {
-						velocity := randVelocity(velocities, event.Velocity, *minFlag, *maxFlag)
-						if velocity != event.Velocity {
-							_, err := w.Seek(event.VelocityByteOffset, io.SeekStart)
-							if err != nil {
-								return err
-							}
-
-							err = binary.Write(w, binary.BigEndian, velocity)
-							if err != nil {
-								return err
-							}
-						}
-					}
-				}
-			}
+func writeRandVelocity(w io.WriteSeeker, decoder *midi.Decoder, h *humanizer) error {
+	for _, p := range h.plan(decoder) {
+		if p.velocity == p.event.Velocity {
+			continue
+		}
+
+		_, err := w.Seek(p.event.VelocityByteOffset, io.SeekStart)
+		if err != nil {
+			return err
+		}
+
+		err = binary.Write(w, binary.BigEndian, p.velocity)
+		if err != nil {
+			return err
 		}
 	}
 
 	return nil
 }
 
+// writeEncoded sets the planned velocities, moves and resizes the notes and
+// encodes the file anew, moved notes cannot be patched in place.
+func writeEncoded(w io.Writer, decoder *midi.Decoder, h *humanizer) error {
+	for _, p := range h.plan(decoder) {
+		p.event.Velocity = p.velocity
+	}
+
+	for i, track := range decoder.Tracks {
+		if !h.selector.track(i, track) {
+			continue
+		}
+
+		notes := track.Notes()
+		if *timingFlag {
+			h.shiftTrack(i, notes, decoder.TicksPerQuarterNote)
+		}
+		if *lengthFlag {
+			h.resizeTrack(i, notes, decoder.TicksPerQuarterNote)
+		}
+	}
+
+	return midi.NewEncoder(w).Encode(decoder)
+}
+
 func main() {
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage: %s \n", os.Args[0])
@@ -102,52 +200,153 @@ func main() {
 		return
 	}
 
-	data, err := importDatabase(*databaseFlag)
+	db, err := importDatabase(*databaseFlag)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	var in, out *os.File
-	in, err = os.Open(*inFlag)
+	data, err := newLookup(db)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	out, err = os.OpenFile(*outFlag, os.O_CREATE|os.O_WRONLY, os.ModePerm)
+	vr, err := newVelocityRange(*rangeFlag, *minFlag, *maxFlag, *kneeFlag)
 	if err != nil {
-		in.Close()
 		log.Fatal(err)
 	}
 
-	defer func() {
-		out.Close()
-		in.Close()
-	}()
+	if *strengthFlag < 0 || *strengthFlag > 100 {
+		log.Fatalf("-strength %d must be within 0-100", *strengthFlag)
+	}
+
+	if *coherenceFlag < 0 || *coherenceFlag > 100 {
+		log.Fatalf("-coherence %d must be within 0-100", *coherenceFlag)
+	}
 
-	_, err = io.Copy(out, in)
+	if *markovFlag < 0 || *markovFlag > 2 {
+		log.Fatalf("-markov %d must be 0, 1 or 2", *markovFlag)
+	}
+	if *markovCrossFlag && *markovFlag == 0 {
+		log.Fatal("-markov-cross needs -markov 1 or 2")
+	}
+
+	if *chordWindowFlag < 0 {
+		log.Fatalf("-chord-window %d must not be negative", *chordWindowFlag)
+	}
+
+	if *maxShiftFlag < 0 {
+		log.Fatalf("-max-shift %d must not be negative", *maxShiftFlag)
+	}
+
+	sel, err := newSelector()
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	_, err = in.Seek(0, 0)
+	var c *config
+	if *configFlag != "" {
+		if c, err = readConfig(*configFlag); err != nil {
+			log.Fatalf("-config: %s", err)
+		}
+	}
+
+	notes, err := newNoteSettings(c, &settings{
+		enabled:   true,
+		vr:        vr,
+		strength:  float64(*strengthFlag) / 100,
+		coherence: float64(*coherenceFlag) / 100,
+	}, data)
+	if err != nil {
+		log.Fatalf("-config: %s", err)
+	}
+
+	var in, out *os.File
+	in, err = os.Open(*inFlag)
 	if err != nil {
 		log.Fatal(err)
 	}
-	_, err = out.Seek(0, 0)
+
+	out, err = os.OpenFile(*outFlag, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.ModePerm)
 	if err != nil {
+		in.Close()
 		log.Fatal(err)
 	}
 
+	defer func() {
+		out.Close()
+		in.Close()
+	}()
+
+	// notes are patched in a copy of the input unless -timing or -length move
+	// them
+	encode := *timingFlag || *lengthFlag
+	if !encode {
+		_, err = io.Copy(out, in)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		_, err = in.Seek(0, 0)
+		if err != nil {
+			log.Fatal(err)
+		}
+		_, err = out.Seek(0, 0)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	decoder := midi.NewDecoder(in)
+	decoder.KeepMessages = encode
 	err = decoder.Decode()
 
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	err = writeRandVelocity(out, decoder, data)
+	if encode && decoder.TimeFormat != midi.MetricalTF {
+		log.Fatal("-timing and -length need a file timed in ticks per quarter note")
+	}
+
+	seed := *seedFlag
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	fmt.Fprintf(os.Stderr, "seed: %d\n", seed)
+
+	r := newReport(seed, *reportFlag != "")
+	h := &humanizer{
+		data:            data,
+		selector:        sel,
+		settings:        notes,
+		rng:             rand.New(rand.NewSource(seed)),
+		report:          r,
+		preserveAccents: *preserveAccentsFlag,
+		maxShift:        *maxShiftFlag,
+		walks:           make(walks),
+		chords:          *chordsFlag,
+		chordWindow:     int64(*chordWindowFlag),
+	}
+	if *markovFlag > 0 {
+		h.markov = newMarkov(*markovFlag, *markovCrossFlag)
+	}
+	if *handsFlag {
+		h.hands = make(map[*midi.Event]sticking.Hand)
+	}
+	if encode {
+		err = writeEncoded(out, decoder, h)
+	} else {
+		err = writeRandVelocity(out, decoder, h)
+	}
 
 	if err != nil {
 		log.Fatal(err)
 	}
+
+	r.print(os.Stderr, data.chain)
+	if *reportFlag != "" {
+		if err = r.write(*reportFlag); err != nil {
+			log.Fatal(err)
+		}
+	}
 }
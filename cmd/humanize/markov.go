@@ -0,0 +1,65 @@
+package main
+
+import (
+	"github.com/Garik-/humanize/pkg/database"
+	"github.com/Garik-/humanize/pkg/midi"
+)
+
+// markovTables names the transition tables in the report.
+var markovTables = map[uint8]string{
+	database.CrossTransition: "cross",
+	database.Transition2:     "second",
+	database.Transition:      "first",
+}
+
+// markov draws Note On velocities from the transitions that follow the hits
+// before them, the velocities humanize gave them. A hit whose context none of
+// the tables has seen gets the values of its position.
+type markov struct {
+	tables    []uint8 // tried in order
+	histories map[int]*database.History
+}
+
+func newMarkov(order int, cross bool) *markov {
+	m := &markov{histories: make(map[int]*database.History)}
+	if cross {
+		m.tables = append(m.tables, database.CrossTransition)
+	}
+	if order > 1 {
+		m.tables = append(m.tables, database.Transition2)
+	}
+	m.tables = append(m.tables, database.Transition)
+	return m
+}
+
+func (m *markov) history(track int) *database.History {
+	h, ok := m.histories[track]
+	if !ok {
+		h = database.NewHistory()
+		m.histories[track] = h
+	}
+	return h
+}
+
+// values returns the velocities that follow the hits before the event in its
+// track and the table they were found in.
+func (m *markov) values(data *lookup, track int, event *midi.Event) ([]int, uint8, int, bool) {
+	history := m.history(track)
+	key := database.NoteKey(event.Note)
+
+	for _, msgType := range m.tables {
+		context, ok := history.Context(msgType, key)
+		if !ok {
+			continue
+		}
+		if values, ok := data.exact(msgType, event.Note, context); ok {
+			return values, msgType, context, true
+		}
+	}
+	return nil, 0, 0, false
+}
+
+// add records the velocity a hit of the track got.
+func (m *markov) add(track int, event *midi.Event, velocity uint8) {
+	m.history(track).Add(database.NoteKey(event.Note), int(velocity))
+}
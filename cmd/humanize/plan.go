@@ -0,0 +1,246 @@
+package main
+
+import (
+	"github.com/Garik-/humanize/pkg/database"
+	"github.com/Garik-/humanize/pkg/midi"
+	"github.com/Garik-/humanize/pkg/sticking"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// planned is the velocity an event gets, the events are planned first so
+// that rules spanning several events can adjust them before anything is
+// written.
+type planned struct {
+	track    int
+	event    *midi.Event
+	velocity uint8
+}
+
+type humanizer struct {
+	data            *lookup
+	selector        *selector
+	settings        *noteSettings
+	rng             *rand.Rand
+	report          *report
+	preserveAccents bool
+	maxShift        int // the most ticks at database.TimingResolution a note start moves
+	walks           walks
+	markov          *markov                       // nil draws velocities from their positions only
+	hands           map[*midi.Event]sticking.Hand // the hands of the hi-hat and ride hits, nil without -hands
+	chords          bool
+	chordWindow     int64 // ticks at database.TimingResolution the hits of a chord start apart
+}
+
+// blend moves the input velocity towards the sampled one by the strength,
+// 0-1.
+func blend(input uint8, sampled uint8, strength float64) uint8 {
+	v := float64(input) + (float64(sampled)-float64(input))*strength
+	return uint8(math.Round(v))
+}
+
+func (h *humanizer) plan(decoder *midi.Decoder) []*planned {
+	var plans []*planned
+
+	if h.hands != nil {
+		h.assignHands(decoder)
+	}
+
+	for i, track := range decoder.Tracks {
+		if !h.selector.track(i, track) {
+			continue
+		}
+
+		events := track.Events
+		var chords *chordPlan
+		if h.chords {
+			events, chords = h.orderChords(track.Events, decoder.TicksPerQuarterNote)
+		}
+
+		for _, event := range events {
+			if event.Velocity == 0 || !h.data.rewrites(event.MsgType) {
+				continue
+			}
+
+			p := h.planEvent(i, event, chords)
+			if p != nil {
+				plans = append(plans, p)
+			}
+
+			// the hits left alone are part of the context of the next ones
+			velocity := event.Velocity
+			if p != nil {
+				velocity = p.velocity
+			}
+			if h.markov != nil && event.MsgType == database.NoteOn {
+				h.markov.add(i, event, velocity)
+			}
+			chords.give(event, velocity)
+		}
+	}
+
+	if h.hands != nil {
+		h.applyHands(plans)
+	}
+	if h.preserveAccents {
+		preserveAccents(plans, newBars(decoder))
+	}
+
+	return plans
+}
+
+// planEvent returns the velocity of an event, nil if it is left as it is. A
+// hit of a chord goes with its anchor, a Note On follows the hits before it
+// with -markov and everything else takes the values of its position.
+func (h *humanizer) planEvent(track int, event *midi.Event, chords *chordPlan) *planned {
+	if !h.selector.event(event) {
+		return nil
+	}
+
+	s := h.settings.get(event.Note)
+	if !s.enabled {
+		return nil
+	}
+
+	velocities := h.chordValues(track, event, chords)
+	if velocities == nil {
+		velocities = h.transitions(track, event)
+	}
+	if velocities == nil {
+		var level string
+		velocities, level = h.data.values(event)
+		h.report.add(track, event, level)
+		if level == levelNone {
+			return nil
+		}
+	}
+
+	velocity := blend(event.Velocity, h.sample(track, event, s, velocities), s.strength)
+	// a Note On with velocity 0 is a Note Off
+	if velocity == 0 && event.MsgType == database.NoteOn {
+		velocity = 1
+	}
+
+	return &planned{track: track, event: event, velocity: velocity}
+}
+
+// transitions returns the velocities of the Markov model for a Note On, nil
+// when there is no model or it has not seen the context.
+func (h *humanizer) transitions(track int, event *midi.Event) []int {
+	if h.markov == nil || event.MsgType != database.NoteOn {
+		return nil
+	}
+
+	values, msgType, context, ok := h.markov.values(h.data, track, event)
+	if !ok {
+		return nil
+	}
+	h.report.addNote(msgType, track, event, context, markovTables[msgType])
+	return values
+}
+
+// sample draws a velocity, a coherent note from the walk of its instrument.
+func (h *humanizer) sample(track int, event *midi.Event, s *settings, velocities []int) uint8 {
+	if s.coherence == 0 {
+		return s.vr.pick(h.rng, velocities, event.Velocity)
+	}
+
+	name := h.data.family(event.Note)
+	if name == "" {
+		name = database.NoteKey(event.Note)
+	}
+	u := h.walks.next(h.rng, instrument{track, event.MsgType, name}, s.coherence)
+	return s.vr.pickQuantile(u, velocities, event.Velocity)
+}
+
+// bars finds the bar of a tick across time signature changes.
+type bars struct {
+	starts []int64 // tick of each time signature change, the first is 0
+	bars   []int64 // bar number at each change
+	ticks  []int64 // ticks per bar from each change on
+}
+
+func newBars(decoder *midi.Decoder) *bars {
+	signatures := append([]midi.TimeSignature(nil), decoder.TimeSignatures...)
+	sort.SliceStable(signatures, func(i, j int) bool { return signatures[i].AbsTicks < signatures[j].AbsTicks })
+	if len(signatures) == 0 || signatures[0].AbsTicks > 0 {
+		signatures = append([]midi.TimeSignature{{Numerator: 4, Denominator: 4}}, signatures...)
+	}
+
+	b := &bars{}
+	quarter := int64(decoder.TicksPerQuarterNote)
+	for _, ts := range signatures {
+		ticks := quarter * 4 * int64(ts.Numerator) / int64(ts.Denominator)
+		if ticks <= 0 {
+			ticks = quarter * 4
+		}
+
+		bar := int64(0)
+		if n := len(b.starts); n > 0 {
+			// a change in the middle of a bar starts a new one
+			bar = b.bars[n-1] + (ts.AbsTicks-b.starts[n-1]+b.ticks[n-1]-1)/b.ticks[n-1]
+		}
+
+		b.starts = append(b.starts, ts.AbsTicks)
+		b.bars = append(b.bars, bar)
+		b.ticks = append(b.ticks, ticks)
+	}
+
+	return b
+}
+
+func (b *bars) bar(tick int64) int64 {
+	i := sort.Search(len(b.starts), func(i int) bool { return b.starts[i] > tick }) - 1
+	if i < 0 {
+		i = 0
+	}
+	return b.bars[i] + (tick-b.starts[i])/b.ticks[i]
+}
+
+// preserveAccents hands out the planned velocities of each note in a bar in
+// the order of the input velocities, so an accent of the input stays the
+// loudest hit of its bar. Different notes are not compared, a kick is not an
+// accent of the hi-hat.
+func preserveAccents(plans []*planned, b *bars) {
+	type group struct {
+		track   int
+		msgType uint8
+		note    uint8
+		bar     int64
+	}
+
+	groups := make(map[group][]*planned)
+	var order []group
+	for _, p := range plans {
+		g := group{p.track, p.event.MsgType, p.event.Note, b.bar(p.event.AbsTicks)}
+		if _, ok := groups[g]; !ok {
+			order = append(order, g)
+		}
+		groups[g] = append(groups[g], p)
+	}
+
+	for _, g := range order {
+		members := groups[g]
+
+		velocities := make([]int, len(members))
+		for i, p := range members {
+			velocities[i] = int(p.velocity)
+		}
+		sort.Ints(velocities)
+
+		// equal input velocities keep the order of their sampled ones, not the
+		// order of the events, which would turn every bar into a crescendo
+		byInput := append([]*planned(nil), members...)
+		sort.SliceStable(byInput, func(i, j int) bool {
+			a, b := byInput[i], byInput[j]
+			if a.event.Velocity != b.event.Velocity {
+				return a.event.Velocity < b.event.Velocity
+			}
+			return a.velocity < b.velocity
+		})
+		for i, p := range byInput {
+			p.velocity = uint8(velocities[i])
+		}
+	}
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/Garik-/humanize/pkg/database"
+	"github.com/Garik-/humanize/pkg/drummap"
+	"github.com/Garik-/humanize/pkg/midi"
+	"github.com/Garik-/humanize/pkg/sticking"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+// groove is a bar of sixteenth closed hi-hats on channel 10 with a kick and a
+// crash on every quarter note, at 480 ticks per quarter note.
+func groove() []byte {
+	type message struct {
+		tick   int64
+		status byte
+		note   byte
+		value  byte
+	}
+
+	var messages []message
+	add := func(tick int64, note byte, velocity byte) {
+		messages = append(messages,
+			message{tick, 0x99, note, velocity},
+			message{tick + 60, 0x89, note, 64})
+	}
+	for i := int64(0); i < 16; i++ {
+		add(i*120, 42, 80)
+		if i%4 == 0 {
+			add(i*120, 36, 100)
+			add(i*120+5, 49, 90)
+		}
+	}
+	sort.SliceStable(messages, func(i, j int) bool { return messages[i].tick < messages[j].tick })
+
+	var track bytes.Buffer
+	last := int64(0)
+	for _, m := range messages {
+		delta := m.tick - last
+		last = m.tick
+		if delta >= 0x80 {
+			track.WriteByte(byte(0x80 | delta>>7))
+		}
+		track.Write([]byte{byte(delta & 0x7F), m.status, m.note, m.value})
+	}
+	track.Write([]byte{0x00, 0xFF, 0x2F, 0x00})
+
+	var file bytes.Buffer
+	file.WriteString("MThd")
+	binary.Write(&file, binary.BigEndian, []uint32{6})
+	binary.Write(&file, binary.BigEndian, []uint16{0, 1, 480})
+	file.WriteString("MTrk")
+	binary.Write(&file, binary.BigEndian, uint32(track.Len()))
+	file.Write(track.Bytes())
+	return file.Bytes()
+}
+
+// testDatabase has values for every position, transition context, hand and
+// chord of the notes of groove and test.mid.
+func testDatabase() *database.Database {
+	db := database.New()
+	db.Transition = make(database.Table)
+	db.Transition2 = make(database.Table)
+	db.CrossTransition = make(database.Table)
+	db.HandVelocity = make(database.Table)
+	db.Chord = make(database.Table)
+	for _, key := range []string{"35", "36", "42", "49"} {
+		db.NoteOn[key] = database.Positions{}
+		for position := 0; position < 4; position++ {
+			db.NoteOn[key][position] = database.Histogram{40: 1, 60: 2, 80: 3, 100: 2, 120: 1}
+		}
+
+		db.Transition[key] = database.Positions{}
+		db.Transition2[key] = database.Positions{}
+		db.CrossTransition[key] = database.Positions{}
+		for bin := 0; bin < database.VelocityBins; bin++ {
+			db.Transition[key][bin] = database.Histogram{50: 1, 70: 1, 90: 1}
+			for other := 0; other < database.VelocityBins; other++ {
+				context := bin*database.VelocityBins + other
+				db.Transition2[key][context] = database.Histogram{55: 1, 75: 1, 95: 1}
+				db.CrossTransition[key][context] = database.Histogram{45: 1, 65: 1, 85: 1}
+			}
+		}
+	}
+
+	db.HandVelocity["42"] = database.Positions{
+		int(sticking.Lead):  {5: 1, 10: 1},
+		int(sticking.Other): {-10: 1, -5: 1},
+	}
+
+	db.Chord["36+49"] = database.Positions{}
+	for bin := 0; bin < database.VelocityBins; bin++ {
+		db.Chord["36+49"][bin] = database.Histogram{20: 1, 25: 1, 30: 1}
+	}
+	return db
+}
+
+// newTestHumanizer uses every table that keeps state between events: the
+// coherence walks, the Markov histories, the hands and the chords.
+func newTestHumanizer(t *testing.T, db *database.Database, seed int64) *humanizer {
+	data := &lookup{
+		tables: map[uint8]database.Table{
+			database.NoteOn:          db.NoteOn,
+			database.Transition:      db.Transition,
+			database.Transition2:     db.Transition2,
+			database.CrossTransition: db.CrossTransition,
+			database.HandVelocity:    db.HandVelocity,
+			database.Chord:           db.Chord,
+		},
+		chain: []string{levelExact, levelNearest},
+	}
+	var err error
+	data.dbMap, err = drummap.Load("gm")
+	require.NoError(t, err)
+
+	vr, err := newVelocityRange(rangeReject, 0, 127, 10)
+	require.NoError(t, err)
+
+	notes, err := newNoteSettings(nil, &settings{enabled: true, vr: vr, strength: 1, coherence: 0.5}, data)
+	require.NoError(t, err)
+
+	return &humanizer{
+		data:        data,
+		selector:    &selector{},
+		settings:    notes,
+		rng:         rand.New(rand.NewSource(seed)),
+		report:      newReport(seed, true),
+		walks:       make(walks),
+		markov:      newMarkov(2, true),
+		hands:       make(map[*midi.Event]sticking.Hand),
+		chords:      true,
+		chordWindow: 20,
+	}
+}
+
+func planVelocities(t *testing.T, data []byte, seed int64) []uint8 {
+	decoder := midi.NewDecoder(bytes.NewReader(data))
+	require.NoError(t, decoder.Decode())
+
+	var velocities []uint8
+	for _, p := range newTestHumanizer(t, testDatabase(), seed).plan(decoder) {
+		velocities = append(velocities, p.velocity)
+	}
+	return velocities
+}
+
+func TestPlan_Seed(t *testing.T) {
+	test, err := ioutil.ReadFile("../../pkg/midi/test.mid")
+	require.NoError(t, err)
+
+	for name, data := range map[string][]byte{"test.mid": test, "groove": groove()} {
+		t.Run(name, func(t *testing.T) {
+			first := planVelocities(t, data, 42)
+			require.NotEmpty(t, first)
+
+			for i := 0; i < 10; i++ {
+				assert.Equal(t, first, planVelocities(t, data, 42))
+			}
+		})
+	}
+}
+
+func TestPlan_Chords(t *testing.T) {
+	decoder := midi.NewDecoder(bytes.NewReader(groove()))
+	require.NoError(t, decoder.Decode())
+
+	h := newTestHumanizer(t, testDatabase(), 1)
+	plans := h.plan(decoder)
+
+	// every hit is planned once, whichever hit of a chord is its anchor
+	hits := 0
+	for _, e := range decoder.Tracks[0].Events {
+		if e.MsgType == database.NoteOn && e.Velocity > 0 {
+			hits++
+		}
+	}
+	seen := make(map[*midi.Event]bool)
+	for _, p := range plans {
+		assert.False(t, seen[p.event], "%d at %d planned twice", p.event.Note, p.event.AbsTicks)
+		seen[p.event] = true
+	}
+	assert.Len(t, plans, hits)
+
+	var crashes []uint8
+	for _, p := range plans {
+		if p.event.Note == 49 {
+			crashes = append(crashes, p.velocity)
+		}
+	}
+
+	// the crashes are drawn once, from the chord table, and the Markov
+	// history keeps the velocity they were given
+	require.Len(t, crashes, 4)
+	for _, v := range crashes {
+		assert.Contains(t, []uint8{20, 25, 30}, v)
+	}
+	assert.Equal(t, 4, h.report.Chords[levelExact])
+
+	context, ok := h.markov.history(0).Context(database.Transition, "49")
+	require.True(t, ok)
+	assert.Equal(t, database.Context(int(crashes[3])), context)
+}
+
+func TestBars(t *testing.T) {
+	cases := []struct {
+		name       string
+		signatures []midi.TimeSignature
+		ticks      []int64
+		want       []int64
+	}{
+		{
+			"4/4 without a time signature",
+			nil,
+			[]int64{0, 1919, 1920, 3840},
+			[]int64{0, 0, 1, 2},
+		},
+		{
+			"3/4",
+			[]midi.TimeSignature{{AbsTicks: 0, Numerator: 3, Denominator: 4}},
+			[]int64{1439, 1440, 2880},
+			[]int64{0, 1, 2},
+		},
+		{
+			"6/8",
+			[]midi.TimeSignature{{AbsTicks: 0, Numerator: 6, Denominator: 8}},
+			[]int64{1439, 1440},
+			[]int64{0, 1},
+		},
+		{
+			"change on a bar line",
+			[]midi.TimeSignature{{AbsTicks: 0, Numerator: 4, Denominator: 4}, {AbsTicks: 1920, Numerator: 3, Denominator: 4}},
+			[]int64{1919, 1920, 3359, 3360},
+			[]int64{0, 1, 1, 2},
+		},
+		{
+			"change in the middle of a bar starts a new one",
+			[]midi.TimeSignature{{AbsTicks: 0, Numerator: 4, Denominator: 4}, {AbsTicks: 960, Numerator: 7, Denominator: 8}},
+			[]int64{959, 960, 2639, 2640},
+			[]int64{0, 1, 1, 2},
+		},
+		{
+			"4/4 before the first time signature",
+			[]midi.TimeSignature{{AbsTicks: 3840, Numerator: 3, Denominator: 4}},
+			[]int64{3839, 3840, 5280},
+			[]int64{1, 2, 3},
+		},
+		{
+			"unsorted",
+			[]midi.TimeSignature{{AbsTicks: 1920, Numerator: 3, Denominator: 4}, {AbsTicks: 0, Numerator: 4, Denominator: 4}},
+			[]int64{1919, 1920, 3360},
+			[]int64{0, 1, 2},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			b := newBars(&midi.Decoder{TicksPerQuarterNote: testTicksPerQuarterNote, TimeSignatures: c.signatures})
+			for i, tick := range c.ticks {
+				assert.Equal(t, c.want[i], b.bar(tick), "tick %d", tick)
+			}
+		})
+	}
+}
+
+func TestPreserveAccents(t *testing.T) {
+	fourFour := newBars(&midi.Decoder{TicksPerQuarterNote: testTicksPerQuarterNote})
+	threeFour := newBars(&midi.Decoder{
+		TicksPerQuarterNote: testTicksPerQuarterNote,
+		TimeSignatures:      []midi.TimeSignature{{AbsTicks: 0, Numerator: 3, Denominator: 4}},
+	})
+
+	// each hit is its note, tick, input velocity and planned velocity
+	cases := []struct {
+		name string
+		bars *bars
+		hits [][4]int
+		want []uint8
+	}{
+		{
+			"the accent gets the loudest",
+			fourFour,
+			[][4]int{{42, 0, 80, 100}, {42, 120, 120, 70}, {42, 240, 80, 90}, {42, 360, 80, 60}},
+			[]uint8{90, 100, 70, 60},
+		},
+		{
+			"equal input velocities keep their planned order",
+			fourFour,
+			[][4]int{{42, 0, 80, 90}, {42, 120, 80, 60}, {42, 240, 80, 100}, {42, 360, 80, 70}},
+			[]uint8{90, 60, 100, 70},
+		},
+		{
+			"softer input",
+			fourFour,
+			[][4]int{{42, 0, 40, 100}, {42, 120, 80, 60}},
+			[]uint8{60, 100},
+		},
+		{
+			"notes are apart",
+			fourFour,
+			[][4]int{{36, 0, 120, 60}, {42, 0, 60, 100}},
+			[]uint8{60, 100},
+		},
+		{
+			"bars are apart",
+			fourFour,
+			[][4]int{{42, 0, 120, 60}, {42, 1920, 60, 100}},
+			[]uint8{60, 100},
+		},
+		{
+			"one bar in 4/4",
+			fourFour,
+			[][4]int{{42, 0, 120, 60}, {42, 1440, 60, 100}},
+			[]uint8{100, 60},
+		},
+		{
+			"two bars in 3/4",
+			threeFour,
+			[][4]int{{42, 0, 120, 60}, {42, 1440, 60, 100}},
+			[]uint8{60, 100},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			plans := make([]*planned, len(c.hits))
+			for i, hit := range c.hits {
+				e := &midi.Event{MsgType: database.NoteOn, Channel: 9, Note: uint8(hit[0]), AbsTicks: int64(hit[1]), Velocity: uint8(hit[2])}
+				plans[i] = &planned{event: e, velocity: uint8(hit[3])}
+			}
+
+			preserveAccents(plans, c.bars)
+
+			velocities := make([]uint8, len(plans))
+			for i, p := range plans {
+				velocities[i] = p.velocity
+			}
+			assert.Equal(t, c.want, velocities)
+		})
+	}
+}
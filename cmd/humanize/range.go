@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// How a sampled value is brought into -min and -max.
+const (
+	rangeReject   = "reject"   // draw again, keep the velocity of the input when nothing fits
+	rangeRescale  = "rescale"  // map the lowest to the highest value of the entry onto min to max
+	rangeClamp    = "clamp"    // cut the value to min or max
+	rangeCompress = "compress" // leave the middle alone and bend the values within the knee of a bound towards it
+)
+
+type velocityRange struct {
+	mode string
+	min  int
+	max  int
+	knee float64
+}
+
+func newVelocityRange(mode string, min int, max int, knee float64) (*velocityRange, error) {
+	switch mode {
+	case rangeReject, rangeRescale, rangeClamp, rangeCompress:
+	default:
+		return nil, fmt.Errorf("-range: unknown mode %q, use reject, rescale, clamp or compress", mode)
+	}
+	if min < 0 || max > 127 || min > max {
+		return nil, fmt.Errorf("-min %d and -max %d must be within 0-127", min, max)
+	}
+	if knee < 0 {
+		return nil, fmt.Errorf("-knee %g must not be negative", knee)
+	}
+
+	// the knees of both bounds may not overlap
+	if half := float64(max-min) / 2; knee > half {
+		knee = half
+	}
+
+	return &velocityRange{mode: mode, min: min, max: max, knee: knee}, nil
+}
+
+// pick draws one of the values, which are sorted, and brings it into range.
+func (r *velocityRange) pick(rng *rand.Rand, values []int, def uint8) uint8 {
+	if r.mode == rangeReject {
+		return randVelocity(rng, values, def, r.min, r.max)
+	}
+
+	return r.fit(values[rng.Intn(len(values))], values)
+}
+
+// pickQuantile takes the value at the quantile u, 0-1, of the values instead
+// of a random one. The reject mode takes it from the values within range.
+func (r *velocityRange) pickQuantile(u float64, values []int, def uint8) uint8 {
+	if r.mode != rangeReject {
+		return r.fit(values[quantileIndex(u, len(values))], values)
+	}
+
+	var within []int
+	for _, v := range values {
+		if v > r.min && v < r.max {
+			within = append(within, v)
+		}
+	}
+	if len(within) == 0 {
+		return def
+	}
+	return uint8(within[quantileIndex(u, len(within))])
+}
+
+// fit brings one of the values into range.
+func (r *velocityRange) fit(v int, values []int) uint8 {
+	value := float64(v)
+
+	switch r.mode {
+	case rangeRescale:
+		low, high := float64(values[0]), float64(values[len(values)-1])
+		if high > low {
+			value = float64(r.min) + (value-low)*float64(r.max-r.min)/(high-low)
+		}
+	case rangeCompress:
+		value = r.compress(value)
+	}
+
+	return uint8(math.Max(float64(r.min), math.Min(float64(r.max), math.Round(value))))
+}
+
+// compress bends the values beyond the knee of a bound exponentially towards
+// the bound, they get close to it but never cross it.
+func (r *velocityRange) compress(value float64) float64 {
+	if r.knee == 0 {
+		return value
+	}
+
+	low, high := float64(r.min)+r.knee, float64(r.max)-r.knee
+	switch {
+	case value > high:
+		return high + r.knee*(1-math.Exp(-(value-high)/r.knee))
+	case value < low:
+		return low - r.knee*(1-math.Exp(-(low-value)/r.knee))
+	}
+	return value
+}
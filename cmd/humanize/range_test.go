@@ -0,0 +1,127 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math/rand"
+	"testing"
+)
+
+func TestNewVelocityRange(t *testing.T) {
+	cases := []struct {
+		name string
+		mode string
+		min  int
+		max  int
+		knee float64
+		want float64 // the knee used
+		err  bool
+	}{
+		{"knee", rangeCompress, 20, 100, 10, 10, false},
+		{"knee limited to half the range", rangeCompress, 40, 60, 30, 10, false},
+		{"empty range", rangeCompress, 60, 60, 5, 0, false},
+		{"unknown mode", "limit", 0, 127, 10, 0, true},
+		{"min above max", rangeClamp, 100, 20, 10, 0, true},
+		{"max above 127", rangeClamp, 0, 128, 10, 0, true},
+		{"negative knee", rangeCompress, 0, 127, -1, 0, true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r, err := newVelocityRange(c.mode, c.min, c.max, c.knee)
+			if c.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, c.want, r.knee)
+		})
+	}
+}
+
+func TestVelocityRange_Fit(t *testing.T) {
+	values := []int{40, 60, 80}
+
+	cases := []struct {
+		name   string
+		mode   string
+		min    int
+		max    int
+		knee   float64
+		value  int
+		values []int
+		want   uint8
+	}{
+		{"rescale lowest", rangeRescale, 20, 100, 0, 40, values, 20},
+		{"rescale middle", rangeRescale, 20, 100, 0, 60, values, 60},
+		{"rescale highest", rangeRescale, 20, 100, 0, 80, values, 100},
+		{"rescale one value", rangeRescale, 20, 100, 0, 110, []int{110}, 100},
+		{"clamp below", rangeClamp, 20, 100, 0, 10, values, 20},
+		{"clamp within", rangeClamp, 20, 100, 0, 50, values, 50},
+		{"clamp above", rangeClamp, 20, 100, 0, 120, values, 100},
+		{"compress middle", rangeCompress, 0, 100, 10, 50, values, 50},
+		{"compress knee start", rangeCompress, 0, 100, 10, 90, values, 90},
+		{"compress above", rangeCompress, 0, 100, 10, 100, values, 96},
+		{"compress far above", rangeCompress, 0, 100, 10, 127, values, 100},
+		{"compress below", rangeCompress, 0, 100, 10, 0, values, 4},
+		{"compress limited knee", rangeCompress, 40, 60, 30, 60, values, 56},
+		{"compress without knee", rangeCompress, 20, 100, 0, 120, values, 100},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r, err := newVelocityRange(c.mode, c.min, c.max, c.knee)
+			require.NoError(t, err)
+			assert.Equal(t, c.want, r.fit(c.value, c.values))
+		})
+	}
+}
+
+func TestVelocityRange_Compress(t *testing.T) {
+	r, err := newVelocityRange(rangeCompress, 20, 100, 10)
+	require.NoError(t, err)
+
+	// the values beyond the knee keep their order and never cross the bound
+	previous := r.compress(90)
+	for v := 91.0; v <= 200; v++ {
+		c := r.compress(v)
+		assert.True(t, c > previous && c < 100, "compress(%g) = %g", v, c)
+		previous = c
+	}
+
+	previous = r.compress(30)
+	for v := 29.0; v >= -100; v-- {
+		c := r.compress(v)
+		assert.True(t, c < previous && c > 20, "compress(%g) = %g", v, c)
+		previous = c
+	}
+}
+
+func TestVelocityRange_Reject(t *testing.T) {
+	r, err := newVelocityRange(rangeReject, 50, 60, 10)
+	require.NoError(t, err)
+	rng := rand.New(rand.NewSource(1))
+
+	// pick draws as many times as there are values, a value that fits may be
+	// missed, pickQuantile looks at the values that fit only
+	cases := []struct {
+		name     string
+		values   []int
+		pick     []uint8
+		quantile uint8
+	}{
+		{"all within", []int{52, 55, 58}, []uint8{52, 55, 58}, 55},
+		{"one within", []int{10, 55, 100}, []uint8{55, 77}, 55},
+		{"none within", []int{10, 20, 100}, []uint8{77}, 77},
+		{"bounds are out", []int{50, 60}, []uint8{77}, 77},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			for i := 0; i < 10; i++ {
+				assert.Contains(t, c.pick, r.pick(rng, c.values, 77))
+			}
+			assert.Equal(t, c.quantile, r.pickQuantile(0.5, c.values, 77))
+		})
+	}
+}
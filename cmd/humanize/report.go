@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Garik-/humanize/pkg/database"
+	"github.com/Garik-/humanize/pkg/midi"
+	"github.com/Garik-/humanize/pkg/sticking"
+	"io"
+	"os"
+)
+
+// served is one event of the input file and where its values came from.
+type served struct {
+	Track    int    `json:"track"`
+	Tick     int64  `json:"tick"`
+	Type     uint8  `json:"type"`
+	Note     uint8  `json:"note"`
+	Position int    `json:"position"`
+	Level    string `json:"level"`
+}
+
+// report counts the events served by each level of the fallback chain, with
+// the seed it is enough to repeat the run.
+type report struct {
+	Seed   int64          `json:"seed"`
+	Levels map[string]int `json:"levels"`
+	Timing map[string]int `json:"timing,omitempty"` // the levels that served the note starts with -timing
+	Length map[string]int `json:"length,omitempty"` // the levels that served the note lengths with -length
+	Markov map[string]int `json:"markov,omitempty"` // the transition tables that served velocities with -markov
+	Hands  map[string]int `json:"hands,omitempty"`  // the hits of hi-hat and ride runs by hand with -hands
+	Chords map[string]int `json:"chords,omitempty"` // the hits whose velocity goes with the anchor of their chord with -chords
+	Events []served       `json:"events,omitempty"`
+
+	events bool // keep every event, not only the counts
+}
+
+func newReport(seed int64, events bool) *report {
+	return &report{Seed: seed, Levels: make(map[string]int), events: events}
+}
+
+func (r *report) add(track int, event *midi.Event, level string) {
+	r.Levels[level]++
+	if r.events {
+		r.Events = append(r.Events, served{
+			Track:    track,
+			Tick:     event.AbsTicks,
+			Type:     event.MsgType,
+			Note:     event.Note,
+			Position: event.QuarterPosition,
+			Level:    level,
+		})
+	}
+}
+
+// addNote counts the level that served the timing offset or the length of a
+// note, or the table other than its position that served its velocity, the
+// position is the one it was looked up at.
+func (r *report) addNote(msgType uint8, track int, event *midi.Event, position int, level string) {
+	counts := &r.Timing
+	switch {
+	case msgType == database.Length:
+		counts = &r.Length
+	case database.IsTransition(msgType):
+		counts = &r.Markov
+	case msgType == database.Chord:
+		counts = &r.Chords
+	case msgType == database.HandVelocity:
+		counts, level = &r.Hands, "velocity "+level
+	case msgType == database.HandTiming:
+		counts, level = &r.Hands, "timing "+level
+	}
+	if *counts == nil {
+		*counts = make(map[string]int)
+	}
+	(*counts)[level]++
+
+	if r.events {
+		r.Events = append(r.Events, served{
+			Track:    track,
+			Tick:     event.AbsTicks,
+			Type:     msgType,
+			Note:     event.Note,
+			Position: position,
+			Level:    level,
+		})
+	}
+}
+
+func (r *report) print(w io.Writer, chain []string) {
+	printLevels(w, "", r.Levels, chain)
+	if len(r.Timing) > 0 {
+		fmt.Fprintln(w, "timing:")
+		printLevels(w, "  ", r.Timing, chain)
+	}
+	if len(r.Length) > 0 {
+		fmt.Fprintln(w, "length:")
+		printLevels(w, "  ", r.Length, chain)
+	}
+	if len(r.Chords) > 0 {
+		fmt.Fprintln(w, "chords:")
+		printLevels(w, "  ", r.Chords, chain)
+	}
+	if len(r.Markov) > 0 {
+		fmt.Fprintln(w, "markov:")
+		for _, msgType := range []uint8{database.CrossTransition, database.Transition2, database.Transition} {
+			name := markovTables[msgType]
+			if n := r.Markov[name]; n > 0 {
+				fmt.Fprintf(w, "  %-8s %d\n", name+":", n)
+			}
+		}
+	}
+	if len(r.Hands) > 0 {
+		fmt.Fprintln(w, "hands:")
+		for _, kind := range []string{"velocity", "timing"} {
+			for _, hand := range []sticking.Hand{sticking.Lead, sticking.Other} {
+				name := kind + " " + hand.String()
+				if n := r.Hands[name]; n > 0 {
+					fmt.Fprintf(w, "  %-15s %d\n", name+":", n)
+				}
+			}
+		}
+	}
+}
+
+func printLevels(w io.Writer, indent string, counts map[string]int, chain []string) {
+	for _, level := range chain {
+		if n := counts[level]; n > 0 {
+			fmt.Fprintf(w, "%s%-8s %d\n", indent, level+":", n)
+		}
+	}
+	if n := counts[levelNone]; n > 0 {
+		fmt.Fprintf(w, "%s%-8s %d\n", indent, levelNone+":", n)
+	}
+}
+
+func (r *report) write(name string) error {
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	encoder := json.NewEncoder(f)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"github.com/Garik-/humanize/pkg/midi"
+	"github.com/Garik-/humanize/pkg/ranges"
+	"regexp"
+)
+
+// selector picks the events humanize rewrites, an empty include list selects
+// everything and an exclude list wins over the include list.
+type selector struct {
+	tracks, excludeTracks     ranges.List // indexes as in the report, from 0
+	trackName, excludeName    *regexp.Regexp
+	channels, excludeChannels ranges.List // 1-16
+	notes, excludeNotes       ranges.List
+}
+
+func newSelector() (*selector, error) {
+	var (
+		s   = &selector{}
+		err error
+	)
+
+	lists := []struct {
+		flag string
+		s    string
+		list *ranges.List
+	}{
+		{"-tracks", *tracksFlag, &s.tracks},
+		{"-exclude-tracks", *excludeTracksFlag, &s.excludeTracks},
+		{"-channel", *channelFlag, &s.channels},
+		{"-exclude-channel", *excludeChannelFlag, &s.excludeChannels},
+		{"-notes", *notesFlag, &s.notes},
+		{"-exclude-notes", *excludeNotesFlag, &s.excludeNotes},
+	}
+	for _, l := range lists {
+		if *l.list, err = ranges.Parse(l.s); err != nil {
+			return nil, fmt.Errorf("%s: %s", l.flag, err)
+		}
+	}
+
+	if *trackNameFlag != "" {
+		if s.trackName, err = regexp.Compile(*trackNameFlag); err != nil {
+			return nil, fmt.Errorf("-track-name: %s", err)
+		}
+	}
+	if *excludeTrackNameFlag != "" {
+		if s.excludeName, err = regexp.Compile(*excludeTrackNameFlag); err != nil {
+			return nil, fmt.Errorf("-exclude-track-name: %s", err)
+		}
+	}
+
+	return s, nil
+}
+
+func selected(include ranges.List, exclude ranges.List, v int) bool {
+	if !include.Empty() && !include.Contains(v) {
+		return false
+	}
+	return !exclude.Contains(v)
+}
+
+func (s *selector) track(i int, track *midi.Track) bool {
+	if !selected(s.tracks, s.excludeTracks, i) {
+		return false
+	}
+	if s.trackName != nil && !s.trackName.MatchString(track.Name) {
+		return false
+	}
+	return s.excludeName == nil || !s.excludeName.MatchString(track.Name)
+}
+
+func (s *selector) event(event *midi.Event) bool {
+	return selected(s.channels, s.excludeChannels, int(event.Channel)+1) &&
+		selected(s.notes, s.excludeNotes, int(event.Note))
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"github.com/Garik-/humanize/pkg/database"
+	"github.com/Garik-/humanize/pkg/midi"
+	"math"
+)
+
+// shift samples an offset from the grid for a note and returns how far its
+// start moves to sit at that offset from its nearest grid line, at most
+// maxShift ticks at database.TimingResolution either way.
+func (h *humanizer) shift(track int, on *midi.Event, ticksPerQuarterNote uint16) int64 {
+	if !h.selector.event(on) || !h.settings.get(on.Note).enabled {
+		return 0
+	}
+
+	line := midi.GridLine(on.AbsTicks, ticksPerQuarterNote)
+
+	// a hit of a hi-hat or ride run takes the timing of its hand
+	offsets, ok := h.handOffsets(track, on)
+	if !ok {
+		position := midi.QuarterPosition(line, ticksPerQuarterNote)
+		var level string
+		offsets, level = h.data.find(database.Timing, on.Note, position)
+		h.report.addNote(database.Timing, track, on, position, level)
+		if level == levelNone {
+			return 0
+		}
+	}
+
+	scale := float64(ticksPerQuarterNote) / database.TimingResolution
+	offset := int64(math.Round(float64(offsets[h.rng.Intn(len(offsets))]) * scale))
+	limit := int64(math.Round(float64(h.maxShift) * scale))
+
+	return clamp(line+offset-on.AbsTicks, -limit, limit)
+}
+
+func clamp(v int64, min int64, max int64) int64 {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
+
+func minInt64(a int64, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt64(a int64, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+type noteKey struct {
+	channel uint8
+	note    uint8
+}
+
+// nextOfKey returns the start of the next note of the same key for each of
+// the notes, math.MaxInt64 for the last one.
+func nextOfKey(notes []*midi.Note) []int64 {
+	next := make([]int64, len(notes))
+	seen := make(map[noteKey]int64)
+	for i := len(notes) - 1; i >= 0; i-- {
+		k := noteKey{notes[i].On.Channel, notes[i].On.Note}
+		if on, ok := seen[k]; ok {
+			next[i] = on
+		} else {
+			next[i] = math.MaxInt64
+		}
+		seen[k] = notes[i].On.AbsTicks
+	}
+	return next
+}
+
+// shiftTrack moves the notes of a track, the end of a note moves with its
+// start. The notes keep their order: a note does not pass the notes that
+// start on the tick before or after its own, it does not start before the
+// previous note of its key has ended and does not run into the next one.
+func (h *humanizer) shiftTrack(track int, notes []*midi.Note, ticksPerQuarterNote uint16) {
+	deltas := make([]int64, len(notes))
+	for i, n := range notes {
+		deltas[i] = h.shift(track, n.On, ticksPerQuarterNote)
+	}
+
+	// the start of the next note of the same key, before anything moves
+	nextOn := nextOfKey(notes)
+
+	lastOff := make(map[noteKey]int64) // the end of the previous note of a key, after it moved
+	previous := int64(0)               // the latest start of the notes on the previous tick, after they moved
+
+	for start := 0; start < len(notes); {
+		tick := notes[start].On.AbsTicks
+		end := start
+		for end < len(notes) && notes[end].On.AbsTicks == tick {
+			end++
+		}
+
+		next := int64(math.MaxInt64)
+		if end < len(notes) {
+			next = notes[end].On.AbsTicks
+		}
+
+		latest := previous
+		for i := start; i < end; i++ {
+			n := notes[i]
+			k := noteKey{n.On.Channel, n.On.Note}
+
+			low, high := previous-tick, next-tick
+			if off, ok := lastOff[k]; ok {
+				// notes that already overlap in the input may stay where they are
+				low = maxInt64(low, minInt64(0, off-tick))
+			}
+			if n.Off != nil && nextOn[i] != math.MaxInt64 {
+				high = minInt64(high, maxInt64(0, nextOn[i]-n.Off.AbsTicks))
+			}
+
+			delta := clamp(deltas[i], minInt64(low, 0), maxInt64(high, 0))
+			n.On.AbsTicks += delta
+			if n.Off != nil {
+				n.Off.AbsTicks += delta
+				lastOff[k] = n.Off.AbsTicks
+			}
+
+			latest = maxInt64(latest, n.On.AbsTicks)
+		}
+
+		previous = latest
+		start = end
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"github.com/Garik-/humanize/pkg/database"
+	"github.com/Garik-/humanize/pkg/midi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math/rand"
+	"testing"
+)
+
+const testTicksPerQuarterNote = 480
+
+// testNote is a note of channel 10 by its note number and the ticks of its
+// Note On and Note Off.
+type testNote [3]int64
+
+func newTestNotes(notes []testNote) []*midi.Note {
+	result := make([]*midi.Note, len(notes))
+	for i, n := range notes {
+		on := &midi.Event{MsgType: 0x9, Channel: 9, Note: uint8(n[0]), Velocity: 100, AbsTicks: n[1]}
+		on.QuarterPosition = midi.QuarterPosition(on.AbsTicks, testTicksPerQuarterNote)
+		off := &midi.Event{MsgType: 0x8, Channel: 9, Note: uint8(n[0]), Velocity: 64, AbsTicks: n[2]}
+		result[i] = &midi.Note{On: on, Off: off}
+	}
+	return result
+}
+
+func testNotesOf(notes []*midi.Note) []testNote {
+	result := make([]testNote, len(notes))
+	for i, n := range notes {
+		result[i] = testNote{int64(n.On.Note), n.On.AbsTicks, n.Off.AbsTicks}
+	}
+	return result
+}
+
+// newTableHumanizer samples the one value given for each key of the table at
+// every position, with the full strength and -max-shift.
+func newTableHumanizer(t *testing.T, msgType uint8, values map[string]int, maxShift int) *humanizer {
+	table := make(database.Table)
+	for key, v := range values {
+		table[key] = make(database.Positions)
+		for position := 0; position < database.PositionsPerBar; position++ {
+			table[key][position] = database.Histogram{v: 1}
+		}
+	}
+
+	data := &lookup{tables: map[uint8]database.Table{msgType: table}, chain: []string{levelExact}}
+	vr, err := newVelocityRange(rangeReject, 0, 127, 10)
+	require.NoError(t, err)
+	notes, err := newNoteSettings(nil, &settings{enabled: true, vr: vr, strength: 1}, data)
+	require.NoError(t, err)
+
+	return &humanizer{
+		data:     data,
+		selector: &selector{},
+		settings: notes,
+		rng:      rand.New(rand.NewSource(1)),
+		report:   newReport(1, false),
+		maxShift: maxShift,
+		walks:    make(walks),
+	}
+}
+
+func TestShiftTrack(t *testing.T) {
+	// the notes sit on grid lines, the offsets are how far they move
+	cases := []struct {
+		name     string
+		offsets  map[string]int
+		maxShift int
+		notes    []testNote
+		want     []testNote
+	}{
+		{
+			"moves with its end",
+			map[string]int{"36": 20},
+			30,
+			[]testNote{{36, 480, 540}},
+			[]testNote{{36, 500, 560}},
+		},
+		{
+			"clamped to max shift late",
+			map[string]int{"36": 100},
+			30,
+			[]testNote{{36, 480, 540}},
+			[]testNote{{36, 510, 570}},
+		},
+		{
+			"clamped to max shift early",
+			map[string]int{"36": -100},
+			30,
+			[]testNote{{36, 480, 540}},
+			[]testNote{{36, 450, 510}},
+		},
+		{
+			"does not pass the previous tick",
+			map[string]int{"36": 100, "38": -200},
+			200,
+			[]testNote{{36, 480, 540}, {38, 720, 780}},
+			[]testNote{{36, 580, 640}, {38, 580, 640}},
+		},
+		{
+			"does not pass the next tick",
+			map[string]int{"36": 200, "38": 0},
+			200,
+			[]testNote{{36, 480, 540}, {38, 600, 660}},
+			[]testNote{{36, 600, 660}, {38, 600, 660}},
+		},
+		{
+			"same-tick group",
+			map[string]int{"36": 100, "38": -100, "42": -200},
+			200,
+			[]testNote{{36, 480, 540}, {38, 480, 540}, {42, 720, 780}},
+			[]testNote{{36, 580, 640}, {38, 380, 440}, {42, 580, 640}},
+		},
+		{
+			"does not run into the next note of its key",
+			map[string]int{"36": 200},
+			200,
+			[]testNote{{36, 480, 600}, {36, 720, 780}},
+			[]testNote{{36, 600, 720}, {36, 920, 980}},
+		},
+		{
+			"does not start before the previous note of its key ends",
+			map[string]int{"36": -300, "38": 0},
+			300,
+			[]testNote{{38, 240, 300}, {36, 480, 700}, {36, 720, 780}},
+			[]testNote{{38, 240, 300}, {36, 240, 460}, {36, 460, 520}},
+		},
+		{
+			"overlapping input early",
+			map[string]int{"36": -100},
+			200,
+			[]testNote{{36, 480, 900}, {36, 720, 1000}},
+			[]testNote{{36, 380, 800}, {36, 720, 1000}},
+		},
+		{
+			"overlapping input late",
+			map[string]int{"36": 100},
+			200,
+			[]testNote{{36, 480, 900}, {36, 720, 1000}},
+			[]testNote{{36, 480, 900}, {36, 820, 1100}},
+		},
+		{
+			"zero length",
+			map[string]int{"36": 100},
+			200,
+			[]testNote{{36, 480, 480}, {36, 720, 780}},
+			[]testNote{{36, 580, 580}, {36, 820, 880}},
+		},
+		{
+			"next of key on the same tick late",
+			map[string]int{"36": 100},
+			200,
+			[]testNote{{36, 480, 540}, {36, 480, 600}},
+			[]testNote{{36, 480, 540}, {36, 580, 700}},
+		},
+		{
+			"next of key on the same tick early",
+			map[string]int{"36": -100},
+			200,
+			[]testNote{{36, 480, 540}, {36, 480, 600}},
+			[]testNote{{36, 380, 440}, {36, 440, 560}},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			h := newTableHumanizer(t, database.Timing, c.offsets, c.maxShift)
+			notes := newTestNotes(c.notes)
+			h.shiftTrack(0, notes, testTicksPerQuarterNote)
+			assert.Equal(t, c.want, testNotesOf(notes))
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+)
+
+// maxEntrySize guards against archive entries that inflate to absurd sizes,
+// no real midi file comes close to it.
+const maxEntrySize = 64 << 20
+
+// source is a midi file on disk or an entry of an archive.
+type source struct {
+	name     string // for archive entries "archive.zip!/dir/file.mid"
+	archived bool
+	data     []byte
+	err      error
+}
+
+func (s *source) read() ([]byte, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	if s.archived {
+		return s.data, nil
+	}
+	return ioutil.ReadFile(s.name)
+}
+
+func isArchive(name string) bool {
+	name = strings.ToLower(name)
+	for _, ext := range []string{".zip", ".tar", ".tar.gz", ".tgz"} {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+func entryName(archive string, name string) string {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	return archive + "!/" + name
+}
+
+func readEntry(r io.Reader) ([]byte, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(r, maxEntrySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxEntrySize {
+		return nil, fmt.Errorf("entry is larger than %d bytes", maxEntrySize)
+	}
+	return data, nil
+}
+
+// archive sends every midi entry of a zip or tar archive, a broken archive is
+// sent as a single failed source so it ends up in the report.
+func (w *walker) archive(name string) bool {
+	var err error
+	if strings.HasSuffix(strings.ToLower(name), ".zip") {
+		err = w.zip(name)
+	} else {
+		err = w.tar(name)
+	}
+
+	if err == errWalkCanceled {
+		return false
+	}
+	if err != nil {
+		return w.send(&source{name: name, err: err})
+	}
+	return true
+}
+
+func (w *walker) zip(name string) error {
+	r, err := zip.OpenReader(name)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() || !w.matches(f.Name) {
+			continue
+		}
+
+		src := &source{name: entryName(name, f.Name), archived: true}
+
+		var rc io.ReadCloser
+		rc, src.err = f.Open()
+		if src.err == nil {
+			src.data, src.err = readEntry(rc)
+			rc.Close()
+		}
+
+		if !w.send(src) {
+			return errWalkCanceled
+		}
+	}
+
+	return nil
+}
+
+func (w *walker) tar(name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	lower := strings.ToLower(name)
+	if strings.HasSuffix(lower, ".gz") || strings.HasSuffix(lower, ".tgz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if !w.matches(header.Name) {
+			continue
+		}
+
+		src := &source{name: entryName(name, header.Name), archived: true}
+		src.data, src.err = readEntry(tr)
+
+		if !w.send(src) {
+			return errWalkCanceled
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testEntries are the archive entries, midi and not, by name.
+var testEntries = map[string]string{
+	"songs/a.mid":   "a",
+	"songs/b.MIDI":  "b",
+	"../escape.mid": "c",
+	"readme.txt":    "d",
+}
+
+func writeZip(t *testing.T, name string) {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for entry, data := range testEntries {
+		f, err := w.Create(entry)
+		require.NoError(t, err)
+		_, err = f.Write([]byte(data))
+		require.NoError(t, err)
+	}
+	_, err := w.Create("songs/dir.mid/")
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.NoError(t, ioutil.WriteFile(name, buf.Bytes(), 0644))
+}
+
+func writeTar(t *testing.T, name string, compress bool) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "songs/dir.mid/", Typeflag: tar.TypeDir, Mode: 0755}))
+	for entry, data := range testEntries {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: entry, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(data))}))
+		_, err := tw.Write([]byte(data))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+
+	data := buf.Bytes()
+	if compress {
+		var gz bytes.Buffer
+		w := gzip.NewWriter(&gz)
+		_, err := w.Write(data)
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+		data = gz.Bytes()
+	}
+	require.NoError(t, ioutil.WriteFile(name, data, 0644))
+}
+
+func TestIsArchive(t *testing.T) {
+	for name, want := range map[string]bool{
+		"a.zip": true, "a.ZIP": true, "a.tar": true, "a.tar.gz": true, "a.tgz": true,
+		"a.gz": false, "a.mid": false, "zip": false,
+	} {
+		assert.Equal(t, want, isArchive(name), name)
+	}
+}
+
+func TestEntryName(t *testing.T) {
+	assert.Equal(t, "a.zip!/songs/a.mid", entryName("a.zip", "songs/a.mid"))
+	assert.Equal(t, "a.zip!/songs/a.mid", entryName("a.zip", "/songs/./a.mid"))
+	assert.Equal(t, "a.zip!/escape.mid", entryName("a.zip", "../escape.mid"))
+}
+
+func TestReadInputs_Archives(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archive")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	writeZip(t, filepath.Join(dir, "songs.zip"))
+	writeTar(t, filepath.Join(dir, "songs.tar"), false)
+	writeTar(t, filepath.Join(dir, "songs.tgz"), true)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "broken.zip"), []byte("not a zip"), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "broken.tar.gz"), []byte("not a gzip"), 0644))
+
+	opts := &walkOptions{extensions: parseExtensions(defaultExtensions)}
+	sources := make(map[string]*source)
+	for src := range readInputs(context.Background(), nil, []string{dir}, opts) {
+		name, err := filepath.Rel(dir, src.name)
+		require.NoError(t, err)
+		sources[filepath.ToSlash(name)] = src
+	}
+
+	var names []string
+	for _, archive := range []string{"songs.tar", "songs.tgz", "songs.zip"} {
+		for entry, data := range map[string]string{"songs/a.mid": "a", "songs/b.MIDI": "b", "escape.mid": "c"} {
+			name := archive + "!/" + entry
+			names = append(names, name)
+
+			src, ok := sources[name]
+			if !assert.True(t, ok, name) {
+				continue
+			}
+			assert.True(t, src.archived)
+			read, err := src.read()
+			require.NoError(t, err)
+			assert.Equal(t, data, string(read), name)
+		}
+	}
+
+	// a broken archive is a single failed source
+	for _, name := range []string{"broken.zip", "broken.tar.gz"} {
+		names = append(names, name)
+		if assert.Contains(t, sources, name) {
+			_, err := sources[name].read()
+			assert.Error(t, err, name)
+		}
+	}
+
+	assert.Len(t, sources, len(names))
+}
+
+func TestReadEntry(t *testing.T) {
+	data, err := readEntry(bytes.NewReader([]byte("midi")))
+	require.NoError(t, err)
+	assert.Equal(t, "midi", string(data))
+
+	_, err = readEntry(bytes.NewReader(make([]byte, maxEntrySize+1)))
+	assert.Error(t, err)
+}
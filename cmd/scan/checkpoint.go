@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/Garik-/humanize/pkg/database"
+	"os"
+	"sort"
+)
+
+var errInterrupted = errors.New("scan interrupted")
+
+// scanState is everything newVelocityMap has aggregated so far, it is what a
+// checkpoint stores and what a resumed scan starts from.
+type scanState struct {
+	notes     noteMap
+	keys      string // what the notes are keyed on
+	stats     *scanStats
+	seen      map[string]bool // hashes of the scanned files
+	completed map[string]bool // names of the sources that need no rescan
+}
+
+func newScanState() *scanState {
+	return &scanState{
+		notes:     make(noteMap),
+		stats:     &scanStats{},
+		seen:      make(map[string]bool),
+		completed: make(map[string]bool),
+	}
+}
+
+type checkpoint struct {
+	Keys       string         `json:"keys"`
+	Completed  []string       `json:"completed"`
+	Hashes     []string       `json:"hashes"`
+	Files      int            `json:"files"`
+	Duplicates int            `json:"duplicates"`
+	Failures   []failure      `json:"failures"`
+	Tracks     int            `json:"tracks"`
+	NoteCount  int            `json:"noteCount"`
+	Skipped    map[string]int `json:"skipped"`
+	Excluded   []exclusion    `json:"excluded"`
+	Notes      noteMap        `json:"notes"`
+}
+
+// UnmarshalJSON reads the velocities of a checkpoint, those written before the
+// samples were counted are sets of values and count as one sample each.
+func (m *velocityMap) UnmarshalJSON(data []byte) error {
+	var counts map[int]int
+	if err := json.Unmarshal(data, &counts); err == nil {
+		*m = counts
+		return nil
+	}
+
+	var set map[int]bool
+	if err := json.Unmarshal(data, &set); err != nil {
+		return err
+	}
+	*m = make(velocityMap, len(set))
+	for velocity, ok := range set {
+		if ok {
+			(*m)[velocity] = 1
+		}
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// writeCheckpoint replaces the checkpoint file atomically, so a crash while
+// writing leaves the previous checkpoint intact.
+func writeCheckpoint(name string, state *scanState) error {
+	tmp := name + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(f)
+	err = encoder.Encode(&checkpoint{
+		Keys:       state.keys,
+		Completed:  sortedKeys(state.completed),
+		Hashes:     sortedKeys(state.seen),
+		Files:      state.stats.files,
+		Duplicates: state.stats.duplicates,
+		Failures:   state.stats.failures,
+		Tracks:     state.stats.tracks,
+		NoteCount:  state.stats.notes,
+		Skipped:    state.stats.skipped,
+		Excluded:   state.stats.excluded,
+		Notes:      state.notes,
+	})
+	if err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+
+	if err = f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return os.Rename(tmp, name)
+}
+
+func readCheckpoint(name string) (*scanState, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var c checkpoint
+	if err = json.NewDecoder(f).Decode(&c); err != nil {
+		return nil, err
+	}
+
+	state := newScanState()
+	state.keys = c.Keys
+	if state.keys == "" {
+		state.keys = database.KeyNotes
+	}
+	if c.Notes != nil {
+		state.notes = c.Notes
+	}
+	state.stats.files = c.Files
+	state.stats.duplicates = c.Duplicates
+	state.stats.failures = c.Failures
+	state.stats.tracks = c.Tracks
+	state.stats.notes = c.NoteCount
+	state.stats.skipped = c.Skipped
+	state.stats.excluded = c.Excluded
+
+	for _, hash := range c.Hashes {
+		state.seen[hash] = true
+	}
+	for _, name := range c.Completed {
+		state.completed[name] = true
+	}
+
+	return state, nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadCheckpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// velocities of a checkpoint written before samples were counted
+	old := filepath.Join(dir, "old.checkpoint")
+	require.NoError(t, ioutil.WriteFile(old, []byte(`{"keys":"notes","files":2,"notes":{"36":{"9":{"0":{"100":true,"110":true}}}}}`), 0644))
+
+	state, err := readCheckpoint(old)
+	require.NoError(t, err)
+	assert.Equal(t, 2, state.stats.files)
+	assert.Equal(t, velocityMap{100: 1, 110: 1}, state.notes["36"][9][0])
+
+	state.notes.add("36", 9, 0, 100, 2)
+	state.completed["a.mid"] = true
+
+	name := filepath.Join(dir, "new.checkpoint")
+	require.NoError(t, writeCheckpoint(name, state))
+
+	state, err = readCheckpoint(name)
+	require.NoError(t, err)
+	assert.Equal(t, velocityMap{100: 3, 110: 1}, state.notes["36"][9][0])
+	assert.True(t, state.completed["a.mid"])
+}
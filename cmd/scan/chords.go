@@ -0,0 +1,29 @@
+package main
+
+import (
+	"github.com/Garik-/humanize/pkg/database"
+	"github.com/Garik-/humanize/pkg/midi"
+)
+
+// addChords records the chord table for the hits of a track played together,
+// every hit of a group is the anchor of the others once. Keys are the
+// database keys of the events.
+func addChords(notes noteMap, events []*midi.Event, keys []string, window int, ticksPerQuarterNote uint16) {
+	key := make(map[*midi.Event]string, len(events))
+	for j, event := range events {
+		key[event] = keys[j]
+	}
+
+	ticks := int64(window) * int64(ticksPerQuarterNote) / database.TimingResolution
+	for _, group := range midi.Simultaneous(events, ticks) {
+		for a, anchor := range group {
+			for m, member := range group {
+				if a == m {
+					continue
+				}
+				chord := database.ChordKey(key[anchor], key[member])
+				notes.add(chord, database.Chord, database.VelocityBin(int(anchor.Velocity)), int(member.Velocity), 1)
+			}
+		}
+	}
+}
@@ -1,80 +1,49 @@
 package main
 
 import (
-	"context"
+	"bytes"
 	"github.com/Garik-/humanize/pkg/midi"
-	"go.uber.org/zap"
-	"os"
-	"sync"
 )
 
 type result struct {
-	name   string
-	tracks []*midi.Track
-	err    error
+	name      string
+	hash      string
+	notesHash string
+	tracks    []*midi.Track
+	ticks     uint16 // per quarter note
+	tempos    []midi.Tempo
+	meters    []midi.TimeSignature
+	err       error
+	offset    int64 // where decoding failed, -1 if the file could not be read
 }
 
-func decodeFile(name string) *result {
-	out := &result{name: name}
-	f, err := os.Open(name)
+func decodeFile(src *source, dedup dedupMode) *result {
+	out := &result{name: src.name, offset: -1}
+	data, err := src.read()
 	if err != nil {
 		out.err = err
 		return out
 	}
 
-	defer f.Close()
+	if dedup != dedupNone {
+		out.hash = fileHash(data)
+	}
 
-	decoder := midi.NewDecoder(f)
+	decoder := midi.NewDecoder(bytes.NewReader(data))
 	err = decoder.Decode()
 	if err != nil {
 		out.err = err
+		out.offset = decoder.Offset()
 		return out
 	}
 
-	out.tracks = decoder.Tracks
-	return out
-}
-
-func decodeRoutine(ctx context.Context, path string, goroutines <-chan struct{}, out chan<- *result, wg *sync.WaitGroup) {
-	log := decoderLog.Named("decodeRoutine")
-	defer wg.Done()
-
-	select {
-	case out <- decodeFile(path):
-	case <-ctx.Done():
-		log.Debug("context done", zap.String("path", path))
+	if dedup == dedupNotes {
+		out.notesHash = notesHash(decoder.Tracks, decoder.TicksPerQuarterNote)
 	}
-	<-goroutines
-}
 
-func decodeWorker(ctx context.Context, paths <-chan string, cntRoutines int) (<-chan *result, <-chan struct{}) {
-	log := decoderLog.Named("decodeWorker")
-	out := make(chan *result)
-	done := make(chan struct{}, 1)
-
-	go func() {
-		var wg sync.WaitGroup
-		goroutines := make(chan struct{}, cntRoutines)
-
-	loop:
-		for path := range paths {
-			select {
-			case goroutines <- struct{}{}:
-			case <-ctx.Done():
-				log.Debug("context done")
-				break loop
-			}
-			wg.Add(1)
-			go decodeRoutine(ctx, path, goroutines, out, &wg)
-		}
-
-		wg.Wait()
-		close(goroutines)
-		close(out)
-
-		done <- struct{}{}
-		close(done)
-	}()
-
-	return out, done
+	out.tracks = decoder.Tracks
+	out.ticks = decoder.TicksPerQuarterNote
+	out.tempos = decoder.Tempos
+	out.meters = decoder.TimeSignatures
+	return out
 }
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"github.com/Garik-/humanize/pkg/midi"
+	"sort"
+)
+
+type dedupMode int
+
+const (
+	dedupNone dedupMode = iota
+	dedupFile
+	dedupNotes
+)
+
+// notesResolution is the ticks per quarter note all events are scaled to
+// before hashing, so the same part saved at 480 and 960 PPQ compares equal.
+const notesResolution = 960
+
+func parseDedupMode(s string) (dedupMode, error) {
+	switch s {
+	case "none":
+		return dedupNone, nil
+	case "file":
+		return dedupFile, nil
+	case "notes":
+		return dedupNotes, nil
+	}
+
+	return dedupNone, fmt.Errorf("unknown dedup mode %q", s)
+}
+
+func fileHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// notesHash hashes the note content of a file ignoring meta events and the
+// way the notes are split into tracks.
+func notesHash(tracks []*midi.Track, ticksPerQuarterNote uint16) string {
+	var events []*midi.Event
+	for _, track := range tracks {
+		events = append(events, track.Events...)
+	}
+
+	ticks := func(e *midi.Event) int64 {
+		if ticksPerQuarterNote == 0 {
+			return e.AbsTicks
+		}
+		return e.AbsTicks * notesResolution / int64(ticksPerQuarterNote)
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		a, b := events[i], events[j]
+		if ticks(a) != ticks(b) {
+			return ticks(a) < ticks(b)
+		}
+		if a.MsgType != b.MsgType {
+			return a.MsgType < b.MsgType
+		}
+		if a.Note != b.Note {
+			return a.Note < b.Note
+		}
+		return a.Velocity < b.Velocity
+	})
+
+	h := sha256.New()
+	buf := make([]byte, 11)
+	for _, e := range events {
+		binary.BigEndian.PutUint64(buf, uint64(ticks(e)))
+		buf[8] = e.MsgType
+		buf[9] = e.Note
+		buf[10] = e.Velocity
+		h.Write(buf)
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
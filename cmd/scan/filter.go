@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"github.com/Garik-/humanize/pkg/database"
+	"github.com/Garik-/humanize/pkg/drummap"
+	"github.com/Garik-/humanize/pkg/midi"
+	"github.com/Garik-/humanize/pkg/ranges"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// reasons a note event is left out of the database by the corpus filter
+const (
+	skipChannel   = "channel"
+	skipNoteRange = "note range"
+	skipTrackName = "track name"
+	skipMeter     = "time signature"
+	skipTempo     = "tempo"
+	skipFewNotes  = "few notes"
+	skipNoteOff   = "note off"
+	skipPressure  = "aftertouch"
+	skipUnmapped  = "not in drum map"
+)
+
+// a file without tempo and time signature events is 120 bpm in 4/4
+var (
+	defaultTempo         = midi.Tempo{MicrosecondsPerQuarter: 500000}
+	defaultTimeSignature = midi.TimeSignature{Numerator: 4, Denominator: 4}
+)
+
+type meter struct {
+	numerator   uint8
+	denominator uint8
+}
+
+// corpusFilter picks the events of a file that go into the database, empty
+// fields do not restrict anything.
+type corpusFilter struct {
+	noteOff    bool // record release velocities
+	aftertouch bool // record polyphonic pressure
+
+	channels  ranges.List // 1-16
+	notes     ranges.List
+	trackName *regexp.Regexp
+	meters    []meter
+	tempo     ranges.List // bpm
+	minNotes  int
+	humanness humannessThresholds
+
+	drumMap       *drummap.Map // the corpus is mapped to, nil keeps notes as they are
+	dbMap         *drummap.Map // the database is written in
+	articulations bool         // key the database on articulation names instead of notes
+
+	chordWindow int // ticks at database.TimingResolution the hits of a chord may start apart
+}
+
+func parseMeters(s string) ([]meter, error) {
+	var meters []meter
+
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		fields := strings.Split(part, "/")
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("bad time signature %q", part)
+		}
+
+		numerator, err := strconv.ParseUint(fields[0], 10, 8)
+		if err != nil {
+			return nil, fmt.Errorf("bad time signature %q", part)
+		}
+		denominator, err := strconv.ParseUint(fields[1], 10, 8)
+		if err != nil {
+			return nil, fmt.Errorf("bad time signature %q", part)
+		}
+
+		meters = append(meters, meter{uint8(numerator), uint8(denominator)})
+	}
+
+	return meters, nil
+}
+
+func (f *corpusFilter) meterMatches(ts midi.TimeSignature) bool {
+	for _, m := range f.meters {
+		if m.numerator == ts.Numerator && m.denominator == ts.Denominator {
+			return true
+		}
+	}
+	return false
+}
+
+// file returns why the whole file is left out or "" if it is not.
+func (f *corpusFilter) file(result *result) string {
+	if len(f.meters) > 0 {
+		timeSignatures := result.meters
+		if len(timeSignatures) == 0 {
+			timeSignatures = []midi.TimeSignature{defaultTimeSignature}
+		}
+		for _, ts := range timeSignatures {
+			if !f.meterMatches(ts) {
+				return skipMeter
+			}
+		}
+	}
+
+	if !f.tempo.Empty() {
+		tempos := result.tempos
+		if len(tempos) == 0 {
+			tempos = []midi.Tempo{defaultTempo}
+		}
+		for _, tempo := range tempos {
+			if !f.tempo.Contains(int(tempo.BPM() + 0.5)) {
+				return skipTempo
+			}
+		}
+	}
+
+	return ""
+}
+
+// track returns why the whole track is left out or "" if it is not.
+func (f *corpusFilter) track(track *midi.Track) string {
+	if f.trackName != nil && !f.trackName.MatchString(track.Name) {
+		return skipTrackName
+	}
+	return ""
+}
+
+// event returns why the event is left out or "" if it is not.
+func (f *corpusFilter) event(event *midi.Event) string {
+	if event.MsgType == database.NoteOff && !f.noteOff {
+		return skipNoteOff
+	}
+	if event.MsgType == database.Aftertouch && !f.aftertouch {
+		return skipPressure
+	}
+	if !f.channels.Empty() && !f.channels.Contains(int(event.Channel)+1) {
+		return skipChannel
+	}
+	if !f.notes.Empty() && !f.notes.Contains(int(event.Note)) {
+		return skipNoteRange
+	}
+	return ""
+}
+
+// key returns the database key of an event, the articulation of its note or
+// the note translated from the drum map of the corpus to the drum map of the
+// database.
+func (f *corpusFilter) key(event *midi.Event) (string, bool) {
+	if f.articulations {
+		m := f.drumMap
+		if m == nil {
+			m = f.dbMap
+		}
+		a, ok := m.Articulation(event.Note)
+		return string(a), ok
+	}
+
+	if f.drumMap == nil {
+		return database.NoteKey(event.Note), true
+	}
+	note, ok := drummap.Translate(f.drumMap, f.dbMap, event.Note)
+	return database.NoteKey(note), ok
+}
+
+// articulation names a database key, "" if the drum map of the database does
+// not know its note.
+func (f *corpusFilter) articulation(key string) drummap.Articulation {
+	if f.articulations {
+		return drummap.Articulation(key)
+	}
+	note, ok := database.ParseNoteKey(key)
+	if !ok {
+		return ""
+	}
+	a, _ := f.dbMap.Articulation(note)
+	return a
+}
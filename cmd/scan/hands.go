@@ -0,0 +1,61 @@
+package main
+
+import (
+	"github.com/Garik-/humanize/pkg/database"
+	"github.com/Garik-/humanize/pkg/midi"
+	"github.com/Garik-/humanize/pkg/sticking"
+	"math"
+)
+
+// instrument is a family played with a sticking on one channel of a track.
+type instrument struct {
+	channel uint8
+	family  string
+}
+
+// addHands records the hand tables for the runs of hi-hat and ride hits in
+// the Note On events of a track, keys are their database keys.
+func addHands(notes noteMap, events []*midi.Event, keys []string, filter *corpusFilter, ticksPerQuarterNote uint16) {
+	hits := make(map[instrument][]int)
+	var order []instrument
+	for j, event := range events {
+		if event.MsgType != database.NoteOn {
+			continue
+		}
+		a := filter.articulation(keys[j])
+		if !sticking.Played(a) {
+			continue
+		}
+
+		i := instrument{event.Channel, a.Family()}
+		if _, ok := hits[i]; !ok {
+			order = append(order, i)
+		}
+		hits[i] = append(hits[i], j)
+	}
+
+	for _, i := range order {
+		indexes := hits[i]
+		ticks := make([]int64, len(indexes))
+		for n, j := range indexes {
+			ticks[n] = events[j].AbsTicks
+		}
+
+		for _, run := range sticking.Runs(ticks, ticksPerQuarterNote) {
+			sum := 0.0
+			for _, j := range indexes[run.Start:run.End] {
+				sum += float64(events[j].Velocity)
+			}
+			mean := sum / float64(run.End-run.Start)
+
+			for n := run.Start; n < run.End; n++ {
+				event, key := events[indexes[n]], keys[indexes[n]]
+				hand := int(run.Hand(event.AbsTicks, ticksPerQuarterNote))
+
+				notes.add(key, database.HandVelocity, hand, int(math.Round(float64(event.Velocity)-mean)), 1)
+				_, offset := gridOffset(event.AbsTicks, ticksPerQuarterNote)
+				notes.add(key, database.HandTiming, hand, offset, 1)
+			}
+		}
+	}
+}
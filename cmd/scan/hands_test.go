@@ -0,0 +1,35 @@
+package main
+
+import (
+	"github.com/Garik-/humanize/pkg/database"
+	"github.com/Garik-/humanize/pkg/drummap"
+	"github.com/Garik-/humanize/pkg/midi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestAddHands_Pedal(t *testing.T) {
+	gm, err := drummap.Load("gm")
+	require.NoError(t, err)
+
+	// sixteenth closed hi-hats with the pedal on the off-beat eighths
+	var (
+		events []*midi.Event
+		keys   []string
+	)
+	for i := int64(0); i < 8; i++ {
+		events = append(events, &midi.Event{MsgType: 0x9, Channel: 9, Note: 42, Velocity: 80, AbsTicks: i * 120})
+		keys = append(keys, "42")
+		if i%4 == 2 {
+			events = append(events, &midi.Event{MsgType: 0x9, Channel: 9, Note: 44, Velocity: 60, AbsTicks: i * 120})
+			keys = append(keys, "44")
+		}
+	}
+
+	notes := make(noteMap)
+	addHands(notes, events, keys, &corpusFilter{dbMap: gm}, 480)
+
+	assert.Equal(t, positionMap{0: {0: 4}, 1: {0: 4}}, notes["42"][database.HandVelocity])
+	assert.NotContains(t, notes, "44")
+}
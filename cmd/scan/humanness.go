@@ -0,0 +1,116 @@
+package main
+
+import (
+	"github.com/Garik-/humanize/pkg/database"
+	"github.com/Garik-/humanize/pkg/midi"
+	"math"
+)
+
+// metricResolution is the ticks per quarter note timing deviations are
+// reported in, whatever the resolution of the file.
+const metricResolution = 480
+
+// reason a note event is left out of the database by the humanness thresholds
+const skipNotHuman = "not human"
+
+// humanness describes how much a track varies from what a step sequencer
+// would produce.
+type humanness struct {
+	VelocityStdDev  float64 `json:"velocityStdDev"`
+	Velocities      int     `json:"velocities"`
+	TimingDeviation float64 `json:"timingDeviation"`
+}
+
+// humannessThresholds exclude tracks that fall below any of them, zero
+// thresholds are disabled.
+type humannessThresholds struct {
+	velocityStdDev  float64
+	velocities      int
+	timingDeviation float64
+}
+
+func (t *humannessThresholds) enabled() bool {
+	return t.velocityStdDev > 0 || t.velocities > 0 || t.timingDeviation > 0
+}
+
+// gridDeviation is the distance of ticks to the nearest line of the 1/16 and
+// of the 1/16 triplet grid, so quantised triplets do not count as played.
+func gridDeviation(ticks int64, ticksPerQuarterNote uint16) float64 {
+	return math.Abs(float64(ticks - midi.GridLine(ticks, ticksPerQuarterNote)))
+}
+
+// gridOffset returns the position of the grid line nearest to ticks and the
+// distance of ticks from it in ticks at database.TimingResolution, negative
+// for a hit ahead of the grid.
+func gridOffset(ticks int64, ticksPerQuarterNote uint16) (int, int) {
+	line := midi.GridLine(ticks, ticksPerQuarterNote)
+	offset := float64(ticks-line) * database.TimingResolution / float64(ticksPerQuarterNote)
+	return midi.QuarterPosition(line, ticksPerQuarterNote), int(math.Round(offset))
+}
+
+// noteLength returns the length of a note in ticks at
+// database.TimingResolution.
+func noteLength(n *midi.Note, ticksPerQuarterNote uint16) int {
+	ticks := float64(n.Off.AbsTicks-n.On.AbsTicks) * database.TimingResolution / float64(ticksPerQuarterNote)
+	return int(math.Round(ticks))
+}
+
+// measureHumanness computes the metrics over the note on events.
+func measureHumanness(events []*midi.Event, ticksPerQuarterNote uint16) humanness {
+	var (
+		h          humanness
+		n          float64
+		sum        float64
+		sumSquares float64
+		deviation  float64
+	)
+
+	velocities := make(map[uint8]bool)
+
+	for _, event := range events {
+		if event.MsgType != 0x9 || event.Velocity == 0 {
+			continue
+		}
+
+		v := float64(event.Velocity)
+		n++
+		sum += v
+		sumSquares += v * v
+		velocities[event.Velocity] = true
+
+		if ticksPerQuarterNote > 0 {
+			deviation += gridDeviation(event.AbsTicks, ticksPerQuarterNote)
+		}
+	}
+
+	if n == 0 {
+		return h
+	}
+
+	mean := sum / n
+	h.VelocityStdDev = math.Sqrt(math.Max(0, sumSquares/n-mean*mean))
+	h.Velocities = len(velocities)
+	if ticksPerQuarterNote > 0 {
+		h.TimingDeviation = deviation / n * metricResolution / float64(ticksPerQuarterNote)
+	}
+
+	return h
+}
+
+// check returns the names of the thresholds h falls below.
+func (t *humannessThresholds) check(h humanness, ticksPerQuarterNote uint16) []string {
+	var reasons []string
+
+	if t.velocityStdDev > 0 && h.VelocityStdDev < t.velocityStdDev {
+		reasons = append(reasons, "velocity stddev")
+	}
+	if t.velocities > 0 && h.Velocities < t.velocities {
+		reasons = append(reasons, "distinct velocities")
+	}
+	// files in SMPTE time have no grid to compare with
+	if t.timingDeviation > 0 && ticksPerQuarterNote > 0 && h.TimingDeviation < t.timingDeviation {
+		reasons = append(reasons, "timing deviation")
+	}
+
+	return reasons
+}
@@ -0,0 +1,12 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestGridDeviation(t *testing.T) {
+	for ticks, want := range map[int64]float64{0: 0, 120: 0, 160: 0, 130: 10, 140: 20, 475: 5, 1925: 5} {
+		assert.Equal(t, want, gridDeviation(ticks, 480), "%d", ticks)
+	}
+}
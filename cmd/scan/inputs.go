@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const defaultExtensions = ".mid,.midi,.smf,.kar,.rmi"
+
+var errWalkCanceled = errors.New("walk canceled")
+
+type walkOptions struct {
+	extensions     map[string]bool
+	followSymlinks bool
+}
+
+func parseExtensions(s string) map[string]bool {
+	extensions := make(map[string]bool)
+	for _, ext := range strings.Split(s, ",") {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if ext == "" {
+			continue
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		extensions[ext] = true
+	}
+	return extensions
+}
+
+type walker struct {
+	ctx     context.Context
+	opts    *walkOptions
+	out     chan<- *source
+	visited map[string]bool // real paths of walked directories, guards against symlink loops
+	sent    map[string]bool // absolute paths of the files sent, a directory and a glob may both reach one
+}
+
+func (w *walker) send(src *source) bool {
+	select {
+	case w.out <- src:
+		return true
+	case <-w.ctx.Done():
+		return false
+	}
+}
+
+func (w *walker) matches(name string) bool {
+	return w.opts.extensions[strings.ToLower(filepath.Ext(name))]
+}
+
+// file sends a file on disk or the entries of an archive, once.
+func (w *walker) file(path string) bool {
+	if abs, err := filepath.Abs(path); err == nil {
+		if w.sent[abs] {
+			return true
+		}
+		w.sent[abs] = true
+	}
+
+	if isArchive(path) {
+		return w.archive(path)
+	}
+	return w.send(&source{name: path})
+}
+
+// input expands a single command line argument or list entry: a file is
+// passed through as is, a directory is walked and a glob pattern is expanded.
+// A path that exists is never a pattern, "Groove [Live].mid" is a file.
+func (w *walker) input(path string) bool {
+	info, err := os.Stat(path)
+	if err == nil && info.IsDir() {
+		return w.dir(path)
+	}
+
+	if err != nil && strings.ContainsAny(path, "*?[") {
+		matches, err := filepath.Glob(path)
+		if err != nil {
+			log.Printf("skip %s: %s", path, err)
+			return true
+		}
+
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil {
+				continue
+			}
+			if info.IsDir() {
+				if !w.dir(match) {
+					return false
+				}
+			} else if w.matches(match) || isArchive(match) {
+				if !w.file(match) {
+					return false
+				}
+			}
+		}
+		return true
+	}
+
+	// missing and unreadable files are reported by the decoder
+	return w.file(path)
+}
+
+func (w *walker) dir(path string) bool {
+	real, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		log.Printf("skip %s: %s", path, err)
+		return true
+	}
+	if w.visited[real] {
+		return true
+	}
+	w.visited[real] = true
+
+	entries, err := ioutil.ReadDir(path)
+	if err != nil {
+		log.Printf("skip %s: %s", path, err)
+		return true
+	}
+
+	for _, entry := range entries {
+		name := filepath.Join(path, entry.Name())
+
+		if entry.Mode()&os.ModeSymlink != 0 {
+			if !w.opts.followSymlinks {
+				continue
+			}
+
+			entry, err = os.Stat(name)
+			if err != nil {
+				log.Printf("skip %s: %s", name, err)
+				continue
+			}
+		}
+
+		if entry.IsDir() {
+			if !w.dir(name) {
+				return false
+			}
+			continue
+		}
+
+		if entry.Mode().IsRegular() && (w.matches(name) || isArchive(name)) {
+			if !w.file(name) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func (w *walker) list(name string) bool {
+	file, err := os.Open(name)
+	if err != nil {
+		log.Printf("skip %s: %s", name, err)
+		return true
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Split(bufio.ScanLines)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if !w.input(line) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// readInputs streams the midi files found in the list files and in the files,
+// directories, archives and glob patterns given as arguments.
+func readInputs(ctx context.Context, lists []string, args []string, opts *walkOptions) <-chan *source {
+	out := make(chan *source)
+
+	w := &walker{
+		ctx:     ctx,
+		opts:    opts,
+		out:     out,
+		visited: make(map[string]bool),
+		sent:    make(map[string]bool),
+	}
+
+	go func() {
+		defer close(out)
+
+		for _, list := range lists {
+			if !w.list(list) {
+				return
+			}
+		}
+
+		for _, arg := range args {
+			if !w.input(arg) {
+				return
+			}
+		}
+	}()
+
+	return out
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// testTree writes empty files under a new temporary directory.
+func testTree(t *testing.T, names ...string) string {
+	dir, err := ioutil.TempDir("", "inputs")
+	require.NoError(t, err)
+
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, ioutil.WriteFile(path, nil, 0644))
+	}
+	return dir
+}
+
+// inputNames reads every input and returns the names of the sources relative
+// to dir, sorted.
+func inputNames(t *testing.T, dir string, lists []string, args []string, opts *walkOptions) []string {
+	var names []string
+	for src := range readInputs(context.Background(), lists, args, opts) {
+		name, err := filepath.Rel(dir, src.name)
+		require.NoError(t, err)
+		names = append(names, filepath.ToSlash(name))
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestParseExtensions(t *testing.T) {
+	assert.Equal(t, map[string]bool{".mid": true, ".kar": true}, parseExtensions("mid, .KAR,,"))
+}
+
+func TestReadInputs(t *testing.T) {
+	dir := testTree(t,
+		"a.mid", "b.MID", "notes.txt",
+		"sub/c.midi", "sub/deep/d.mid",
+		"Groove [Live].mid", "GrooveL.mid",
+	)
+	defer os.RemoveAll(dir)
+
+	opts := &walkOptions{extensions: parseExtensions(defaultExtensions)}
+	join := func(name string) string { return filepath.Join(dir, name) }
+
+	cases := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{
+			"directory",
+			[]string{dir},
+			[]string{"Groove [Live].mid", "GrooveL.mid", "a.mid", "b.MID", "sub/c.midi", "sub/deep/d.mid"},
+		},
+		{
+			"glob",
+			[]string{join("*.mid")},
+			[]string{"Groove [Live].mid", "GrooveL.mid", "a.mid"},
+		},
+		{
+			"glob of directories",
+			[]string{join("s*")},
+			[]string{"sub/c.midi", "sub/deep/d.mid"},
+		},
+		{
+			"a file with glob characters is not a pattern",
+			[]string{join("Groove [Live].mid")},
+			[]string{"Groove [Live].mid"},
+		},
+		{
+			"a file is passed as it is",
+			[]string{join("notes.txt")},
+			[]string{"notes.txt"},
+		},
+		{
+			"a file reached twice is sent once",
+			[]string{join("sub"), join("sub/*/*.mid"), join("sub/deep/d.mid"), join("sub/../a.mid"), join("a.mid")},
+			[]string{"a.mid", "sub/c.midi", "sub/deep/d.mid"},
+		},
+		{
+			"nothing matches",
+			[]string{join("*.kar")},
+			nil,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.want, inputNames(t, dir, nil, c.args, opts))
+		})
+	}
+}
+
+func TestReadInputs_List(t *testing.T) {
+	dir := testTree(t, "a.mid", "sub/b.mid")
+	defer os.RemoveAll(dir)
+
+	list := filepath.Join(dir, "list.txt")
+	require.NoError(t, ioutil.WriteFile(list, []byte(filepath.Join(dir, "a.mid")+"\n\n  "+filepath.Join(dir, "sub")+"\n"), 0644))
+
+	opts := &walkOptions{extensions: parseExtensions(defaultExtensions)}
+	assert.Equal(t, []string{"a.mid", "sub/b.mid"}, inputNames(t, dir, []string{list}, []string{filepath.Join(dir, "a.mid")}, opts))
+}
+
+func TestReadInputs_Symlinks(t *testing.T) {
+	dir := testTree(t, "a.mid", "sub/b.mid")
+	defer os.RemoveAll(dir)
+
+	// a link back to the top would walk forever without the visited guard
+	if err := os.Symlink(dir, filepath.Join(dir, "sub", "loop")); err != nil {
+		t.Skip("no symlinks:", err)
+	}
+	require.NoError(t, os.Symlink(filepath.Join(dir, "a.mid"), filepath.Join(dir, "link.mid")))
+
+	opts := &walkOptions{extensions: parseExtensions(defaultExtensions)}
+	assert.Equal(t, []string{"a.mid", "sub/b.mid"}, inputNames(t, dir, nil, []string{dir}, opts))
+
+	opts.followSymlinks = true
+	assert.Equal(t, []string{"a.mid", "link.mid", "sub/b.mid"}, inputNames(t, dir, nil, []string{dir}, opts))
+}
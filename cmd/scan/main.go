@@ -1,16 +1,19 @@
 package main
 
 import (
-	"bufio"
 	"context"
-	"encoding/json"
 	"flag"
 	"fmt"
+	"github.com/Garik-/humanize/pkg/database"
+	"github.com/Garik-/humanize/pkg/drummap"
+	"github.com/Garik-/humanize/pkg/ranges"
 	"go.uber.org/zap"
 	"log"
 	"os"
 	"os/signal"
+	"regexp"
 	"syscall"
+	"time"
 )
 
 const (
@@ -18,26 +21,41 @@ const (
 )
 
 var (
-	listFlag = flag.String("l", "", "The path to the list of midi files,\nfind . -type f -name \"*.mid\" > midi_list.txt")
-	outFlag  = flag.String("o", "", "The path to output json file")
-	maxFlag  = flag.Int("p", maxGoroutines, "Number of files processed in parallel, must be > 0")
-)
+	listFlag     = flag.String("l", "", "The path to the list of midi files, directories or glob patterns,\nfind . -type f -name \"*.mid\" > midi_list.txt")
+	extFlag      = flag.String("ext", defaultExtensions, "Comma separated extensions of midi files picked up when walking directories")
+	followFlag   = flag.Bool("follow", false, "Follow symbolic links when walking directories")
+	outFlag      = flag.String("o", "", "The path to output json file")
+	maxFlag      = flag.Int("p", maxGoroutines, "Number of files processed in parallel, must be > 0")
+	dedupFlag    = flag.String("dedup", "file", "Skip duplicate files: none, file (identical bytes) or notes (identical note content)")
+	failFastFlag = flag.Bool("fail-fast", false, "Stop at the first file that cannot be decoded instead of skipping it")
+	reportFlag   = flag.String("report", "", "The path to the json report of files that failed to decode and tracks that were excluded")
 
-func readList(file *os.File) (<-chan string, error) {
-	out := make(chan string)
+	checkpointFlag      = flag.String("checkpoint", "", "The path to the checkpoint file, defaults to the output path with .checkpoint appended")
+	checkpointEveryFlag = flag.Duration("checkpoint-every", 5*time.Minute, "How often the checkpoint is written, 0 writes it only when the scan is interrupted")
+	resumeFlag          = flag.Bool("resume", false, "Continue an interrupted scan from its checkpoint")
 
-	scanner := bufio.NewScanner(file)
-	scanner.Split(bufio.ScanLines)
+	statsFlag = flag.String("stats", "", "The path to the json summary of the scan")
 
-	go func() {
-		for scanner.Scan() {
-			out <- scanner.Text()
-		}
-		close(out)
-	}()
+	channelFlag   = flag.String("channel", "", "Only scan these MIDI channels (1-16), e.g. 10 or 1-9,11")
+	notesFlag     = flag.String("notes", "", "Only scan these notes, e.g. 35-81")
+	trackNameFlag = flag.String("track-name", "", "Only scan tracks whose name matches this regular expression")
+	meterFlag     = flag.String("meter", "", "Only scan files in these time signatures, e.g. 4/4,12/8")
+	tempoFlag     = flag.String("tempo", "", "Only scan files whose tempo stays in this bpm range, e.g. 60-200")
+	minNotesFlag  = flag.Int("min-notes", 0, "Skip tracks with fewer note on events left after the other filters")
 
-	return out, nil
-}
+	drumMapFlag = flag.String("map", "", "The drum map of the scanned files, a built-in map (gm, sd3, ezd2, ad2, ssd5) or a json file,\nnotes are translated to the -db-map articulations")
+	dbMapFlag   = flag.String("db-map", "gm", "The drum map the database is written in")
+	keysFlag    = flag.String("keys", database.KeyNotes, "What the database is keyed on: notes or articulations,\narticulation names are read from -map or from -db-map when -map is not set")
+
+	noteOffFlag    = flag.Bool("note-off", false, "Also record Note Off release velocities")
+	aftertouchFlag = flag.Bool("aftertouch", false, "Also record polyphonic aftertouch pressure")
+
+	chordWindowFlag = flag.Int("chord-window", 20, "Hits that start within this many ticks at 480 per quarter note of the first one\nare recorded as played together")
+
+	minStdDevFlag     = flag.Float64("min-velocity-stddev", 0, "Exclude tracks whose note on velocities have a lower standard deviation")
+	minVelocitiesFlag = flag.Int("min-velocities", 0, "Exclude tracks with fewer distinct note on velocities")
+	minDeviationFlag  = flag.Float64("min-timing-deviation", 0, "Exclude tracks whose notes are on average closer to the 1/16 grid,\nin ticks at 480 per quarter note")
+)
 
 func init() {
 	if os.Getenv("DEBUG") != "" {
@@ -46,36 +64,114 @@ func init() {
 	}
 }
 
+func newCorpusFilter() (*corpusFilter, error) {
+	var (
+		f = &corpusFilter{
+			noteOff:     *noteOffFlag,
+			aftertouch:  *aftertouchFlag,
+			minNotes:    *minNotesFlag,
+			chordWindow: *chordWindowFlag,
+			humanness: humannessThresholds{
+				velocityStdDev:  *minStdDevFlag,
+				velocities:      *minVelocitiesFlag,
+				timingDeviation: *minDeviationFlag,
+			},
+		}
+		err error
+	)
+
+	if f.channels, err = ranges.Parse(*channelFlag); err != nil {
+		return nil, fmt.Errorf("-channel: %s", err)
+	}
+	if f.notes, err = ranges.Parse(*notesFlag); err != nil {
+		return nil, fmt.Errorf("-notes: %s", err)
+	}
+	if *trackNameFlag != "" {
+		if f.trackName, err = regexp.Compile(*trackNameFlag); err != nil {
+			return nil, fmt.Errorf("-track-name: %s", err)
+		}
+	}
+	if f.meters, err = parseMeters(*meterFlag); err != nil {
+		return nil, fmt.Errorf("-meter: %s", err)
+	}
+	if f.tempo, err = ranges.Parse(*tempoFlag); err != nil {
+		return nil, fmt.Errorf("-tempo: %s", err)
+	}
+	if f.chordWindow < 0 {
+		return nil, fmt.Errorf("-chord-window %d must not be negative", f.chordWindow)
+	}
+	switch *keysFlag {
+	case database.KeyNotes:
+	case database.KeyArticulations:
+		f.articulations = true
+	default:
+		return nil, fmt.Errorf("-keys: unknown keys %q", *keysFlag)
+	}
+	if *drumMapFlag != "" {
+		if f.drumMap, err = drummap.Load(*drumMapFlag); err != nil {
+			return nil, fmt.Errorf("-map: %s", err)
+		}
+	}
+	// the hand tables find the hi-hats and rides of a database keyed on notes
+	// with it too
+	if f.dbMap, err = drummap.Load(*dbMapFlag); err != nil {
+		return nil, fmt.Errorf("-db-map: %s", err)
+	}
+
+	return f, nil
+}
+
 func main() {
 	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: %s \n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] [file|directory|pattern ...]\n", os.Args[0])
 		flag.PrintDefaults()
 	}
 	flag.Parse()
 
-	if *listFlag == "" || *outFlag == "" || *maxFlag <= 0 {
+	if (*listFlag == "" && flag.NArg() == 0) || *outFlag == "" || *maxFlag <= 0 {
 		flag.Usage()
 		return
 	}
 
-	in, err := os.Open(*listFlag)
+	dedup, err := parseDedupMode(*dedupFlag)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	out, err := os.OpenFile(*outFlag, os.O_CREATE|os.O_WRONLY, os.ModePerm)
+	filter, err := newCorpusFilter()
 	if err != nil {
-		in.Close()
 		log.Fatal(err)
 	}
 
+	var lists []string
+	if *listFlag != "" {
+		if _, err := os.Stat(*listFlag); err != nil {
+			log.Fatal(err)
+		}
+		lists = append(lists, *listFlag)
+	}
+
+	checkpointPath := *checkpointFlag
+	if checkpointPath == "" {
+		checkpointPath = *outFlag + ".checkpoint"
+	}
+
+	var resume *scanState
+	if *resumeFlag {
+		resume, err = readCheckpoint(checkpointPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if resume.keys != *keysFlag {
+			log.Fatalf("the checkpoint is keyed on %s, not %s", resume.keys, *keysFlag)
+		}
+		fmt.Fprintf(os.Stderr, "resuming after %d files\n", resume.stats.files)
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	done := make(chan struct{}, 1)
 
 	defer func() {
-		out.Close()
-		in.Close()
-
 		done <- struct{}{}
 		close(done)
 	}()
@@ -92,61 +188,90 @@ func main() {
 		cancel()
 	}()
 
-	paths, err := readList(in)
-	if err != nil {
-		log.Fatal(err)
+	started := time.Now()
+
+	sources := readInputs(ctx, lists, flag.Args(), &walkOptions{
+		extensions:     parseExtensions(*extFlag),
+		followSymlinks: *followFlag,
+	})
+
+	if resume != nil {
+		sources = skipCompleted(ctx, sources, resume.completed)
+	}
+
+	var p *progress
+	if isTerminal(os.Stderr) {
+		p = newProgress(os.Stderr)
+		sources = p.count(ctx, sources)
+		p.start()
 	}
 
-	var m noteMap
-	m, err = newVelocityMap(ctx, paths, *maxFlag)
+	var (
+		m     noteMap
+		stats *scanStats
+	)
+	m, stats, err = newVelocityMap(ctx, sources, &scanOptions{
+		routines:        *maxFlag,
+		dedup:           dedup,
+		failFast:        *failFastFlag,
+		checkpoint:      checkpointPath,
+		checkpointEvery: *checkpointEveryFlag,
+		resume:          resume,
+		progress:        p,
+		filter:          filter,
+		keys:            *keysFlag,
+	})
+	if p != nil {
+		p.finish()
+	}
+	if err == errInterrupted {
+		log.Fatalf("%s, continue with -resume", err)
+	}
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	// note > type > position > []velocity
-	data := make(map[uint8]map[uint8]map[int][]int)
-	for note, types := range m {
+	s := newSummary(stats, m, time.Since(started))
+	s.print(os.Stderr)
+
+	if *statsFlag != "" {
+		if err := s.write(*statsFlag); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *reportFlag != "" {
+		if err := writeReport(*reportFlag, stats); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	db := database.New()
+	db.Keys = *keysFlag
+	for key, types := range m {
 		for msgType, positions := range types {
 			for position, velocity := range positions {
 				mainLog.Debug("map",
-					zap.Uint8("note", note),
+					zap.String("key", key),
 					zap.Uint8("msgType", msgType),
 					zap.Int("position", position),
-					zap.Int("velocity", len(velocity)),
+					zap.Int("values", len(velocity)),
 				)
 
-				i := 0
-				keys := make([]int, len(velocity))
-				for k := range velocity {
-					keys[i] = int(k)
-					i++
-				}
-
-				if _, ok := data[note]; ok { // check type
-					if _, ok := data[note][msgType]; ok { // check position
-						data[note][msgType][position] = keys
-					} else {
-						positionMap := make(map[int][]int)
-						positionMap[position] = keys
-
-						data[note][msgType] = positionMap
-					}
-				} else {
-					positionMap := make(map[int][]int)
-					positionMap[position] = keys
-
-					msgTypes := make(map[uint8]map[int][]int)
-					msgTypes[msgType] = positionMap
-
-					data[note] = msgTypes
+				for v, n := range velocity {
+					db.AddSamples(msgType, key, position, v, n)
 				}
 			}
 		}
 	}
 
-	encoder := json.NewEncoder(out)
-	err = encoder.Encode(data)
-	if err != nil {
+	// the output is only replaced by a finished scan, an interrupted one
+	// leaves the database of the previous scan as it was
+	if err = db.WriteFile(*outFlag); err != nil {
 		log.Fatal(err)
 	}
+
+	if err = os.Remove(checkpointPath); err != nil && !os.IsNotExist(err) {
+		log.Println(err)
+	}
 }
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+const progressInterval = 250 * time.Millisecond
+
+// progress counts files as they are found and scanned, the counters are
+// updated atomically by the walker and the shards.
+type progress struct {
+	found  int64
+	done   int64
+	failed int64
+	walked int32
+
+	started time.Time
+	w       io.Writer
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+func newProgress(w io.Writer) *progress {
+	return &progress{
+		started: time.Now(),
+		w:       w,
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+}
+
+// count passes the sources through counting them, the total is known once
+// sources is closed.
+func (p *progress) count(ctx context.Context, sources <-chan *source) <-chan *source {
+	out := make(chan *source)
+
+	go func() {
+		defer close(out)
+
+		for src := range sources {
+			atomic.AddInt64(&p.found, 1)
+
+			select {
+			case out <- src:
+			case <-ctx.Done():
+				return
+			}
+		}
+		atomic.StoreInt32(&p.walked, 1)
+	}()
+
+	return out
+}
+
+func (p *progress) scanned(failed bool) {
+	if p == nil {
+		return
+	}
+	atomic.AddInt64(&p.done, 1)
+	if failed {
+		atomic.AddInt64(&p.failed, 1)
+	}
+}
+
+func (p *progress) line() string {
+	found := atomic.LoadInt64(&p.found)
+	done := atomic.LoadInt64(&p.done)
+	failed := atomic.LoadInt64(&p.failed)
+	walked := atomic.LoadInt32(&p.walked) == 1
+
+	elapsed := time.Since(p.started)
+	rate := float64(done) / elapsed.Seconds()
+
+	total := fmt.Sprintf("%d+", found)
+	eta := "?"
+	if walked {
+		total = fmt.Sprint(found)
+		if rate > 0 {
+			eta = time.Duration(float64(found-done) / rate * float64(time.Second)).Round(time.Second).String()
+		}
+	}
+
+	return fmt.Sprintf("%d/%s files, %.1f files/s, eta %s, %d failed", done, total, rate, eta, failed)
+}
+
+// start redraws the progress line until finish is called.
+func (p *progress) start() {
+	go func() {
+		defer close(p.stopped)
+
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				fmt.Fprintf(p.w, "\r%s\033[K", p.line())
+			case <-p.stop:
+				fmt.Fprintf(p.w, "\r%s\033[K\n", p.line())
+				return
+			}
+		}
+	}()
+}
+
+func (p *progress) finish() {
+	close(p.stop)
+	<-p.stopped
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+)
+
+type failure struct {
+	Path   string `json:"path"`
+	Error  string `json:"error"`
+	Offset *int64 `json:"offset,omitempty"`
+}
+
+// exclusion is a track left out because it does not look played by a human.
+type exclusion struct {
+	Path    string    `json:"path"`
+	Track   int       `json:"track"`
+	Name    string    `json:"name,omitempty"`
+	Reasons []string  `json:"reasons"`
+	Metrics humanness `json:"metrics"`
+}
+
+type report struct {
+	Failures []failure   `json:"failures"`
+	Excluded []exclusion `json:"excluded"`
+}
+
+func newFailure(r *result) failure {
+	f := failure{Path: r.name, Error: r.err.Error()}
+	if r.offset >= 0 {
+		offset := r.offset
+		f.Offset = &offset
+	}
+	return f
+}
+
+func writeReport(name string, stats *scanStats) error {
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := report{Failures: stats.failures, Excluded: stats.excluded}
+	if r.Failures == nil {
+		r.Failures = []failure{}
+	}
+	if r.Excluded == nil {
+		r.Excluded = []exclusion{}
+	}
+
+	encoder := json.NewEncoder(f)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+// reasons a note event is left out of the database
+const (
+	skipZeroVelocity = "zero velocity"
+)
+
+type scanStats struct {
+	files      int
+	duplicates int
+	failures   []failure
+	tracks     int
+	notes      int
+	skipped    map[string]int
+	excluded   []exclusion
+}
+
+func (s *scanStats) skip(reason string, n int) {
+	if n == 0 {
+		return
+	}
+	if s.skipped == nil {
+		s.skipped = make(map[string]int)
+	}
+	s.skipped[reason] += n
+}
+
+func (s *scanStats) merge(other *scanStats) {
+	s.files += other.files
+	s.duplicates += other.duplicates
+	s.failures = append(s.failures, other.failures...)
+	s.tracks += other.tracks
+	s.notes += other.notes
+	s.excluded = append(s.excluded, other.excluded...)
+	for reason, n := range other.skipped {
+		s.skip(reason, n)
+	}
+}
+
+type summary struct {
+	Files      int            `json:"files"`
+	Duplicates int            `json:"duplicates"`
+	Failed     int            `json:"failed"`
+	Tracks     int            `json:"tracks"`
+	Notes      int            `json:"notes"`
+	Skipped    map[string]int `json:"skipped"`
+	Excluded   int            `json:"excludedTracks"`
+	Keys       int            `json:"keys"`
+	Seconds    float64        `json:"seconds"`
+}
+
+func newSummary(stats *scanStats, m noteMap, elapsed time.Duration) *summary {
+	s := &summary{
+		Files:      stats.files,
+		Duplicates: stats.duplicates,
+		Failed:     len(stats.failures),
+		Tracks:     stats.tracks,
+		Notes:      stats.notes,
+		Skipped:    stats.skipped,
+		Excluded:   len(stats.excluded),
+		Keys:       len(m),
+		Seconds:    elapsed.Seconds(),
+	}
+	if s.Skipped == nil {
+		s.Skipped = map[string]int{}
+	}
+	return s
+}
+
+func (s *summary) print(w io.Writer) {
+	fmt.Fprintf(w, "files:      %d\n", s.Files)
+	fmt.Fprintf(w, "duplicates: %d\n", s.Duplicates)
+	fmt.Fprintf(w, "failed:     %d\n", s.Failed)
+	fmt.Fprintf(w, "tracks:     %d\n", s.Tracks)
+	fmt.Fprintf(w, "notes:      %d\n", s.Notes)
+
+	reasons := make([]string, 0, len(s.Skipped))
+	for reason := range s.Skipped {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+
+	for _, reason := range reasons {
+		fmt.Fprintf(w, "  skipped, %s: %d\n", reason, s.Skipped[reason])
+	}
+
+	if s.Excluded > 0 {
+		fmt.Fprintf(w, "excluded:   %d tracks\n", s.Excluded)
+	}
+	fmt.Fprintf(w, "keys:       %d\n", s.Keys)
+	fmt.Fprintf(w, "time:       %s\n", time.Duration(s.Seconds*float64(time.Second)).Round(time.Millisecond))
+}
+
+func (s *summary) write(name string) error {
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	encoder := json.NewEncoder(f)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(s)
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"github.com/Garik-/humanize/pkg/database"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestNewSummary_Keys(t *testing.T) {
+	m := noteMap{
+		"36": {database.NoteOn: {0: {100: 1}, 1: {90: 1}}, database.Timing: {0: {5: 1}}},
+		"42": {database.NoteOn: {0: {80: 2}}},
+	}
+
+	s := newSummary(&scanStats{}, m, time.Second)
+	assert.Equal(t, 2, s.Keys)
+}
@@ -2,79 +2,437 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"github.com/Garik-/humanize/pkg/database"
+	"github.com/Garik-/humanize/pkg/midi"
 	"go.uber.org/zap"
+	"sort"
+	"sync"
+	"time"
 )
 
-type velocityMap map[uint8]bool
+// velocity or timing offset -> number of samples
+type velocityMap map[int]int
 type positionMap map[int]velocityMap
 type typeMap map[uint8]positionMap
 
-// note -> type -> position -> velocity
-type noteMap map[uint8]typeMap
+// key -> type -> position -> velocity, the key is a note or an articulation
+type noteMap map[string]typeMap
 
-func newVelocityMap(parent context.Context, paths <-chan string, cntRoutines int) (noteMap, error) {
+type scanOptions struct {
+	routines        int
+	dedup           dedupMode
+	failFast        bool
+	checkpoint      string
+	checkpointEvery time.Duration
+	resume          *scanState // the sources it completed must be dropped, see skipCompleted
+	progress        *progress
+	filter          *corpusFilter
+	keys            string // database.KeyNotes or database.KeyArticulations
+}
+
+func (m noteMap) add(key string, msgType uint8, position int, velocity int, n int) {
+	types, ok := m[key]
+	if !ok {
+		types = make(typeMap)
+		m[key] = types
+	}
+
+	positions, ok := types[msgType]
+	if !ok {
+		positions = make(positionMap)
+		types[msgType] = positions
+	}
+
+	velocities, ok := positions[position]
+	if !ok {
+		velocities = make(velocityMap)
+		positions[position] = velocities
+	}
+
+	velocities[velocity] += n
+}
+
+// merge copies other into m, other can be modified afterwards without
+// affecting m.
+func (m noteMap) merge(other noteMap) {
+	for key, types := range other {
+		for msgType, positions := range types {
+			for position, velocities := range positions {
+				for velocity, n := range velocities {
+					m.add(key, msgType, position, velocity, n)
+				}
+			}
+		}
+	}
+}
+
+func (state *scanState) merge(other *scanState) {
+	state.notes.merge(other.notes)
+	state.stats.merge(other.stats)
+	for hash := range other.seen {
+		state.seen[hash] = true
+	}
+	for name := range other.completed {
+		state.completed[name] = true
+	}
+}
+
+// hashSet is the set of file hashes shared by all shards.
+type hashSet struct {
+	sync.Mutex
+	m map[string]bool
+}
+
+// claim reports whether none of the hashes was seen before and marks them
+// seen, so of several identical files only the first one is aggregated.
+func (s *hashSet) claim(hashes ...string) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, hash := range hashes {
+		if hash != "" && s.m[hash] {
+			return false
+		}
+	}
+	for _, hash := range hashes {
+		if hash != "" {
+			s.m[hash] = true
+		}
+	}
+	return true
+}
+
+// shard decodes files and folds their events into its own partial state, the
+// partial states of all shards are merged when the scan ends.
+type shard struct {
+	sync.Mutex
+	state *scanState
+}
+
+func (sh *shard) run(ctx context.Context, sources <-chan *source, seen *hashSet, opts *scanOptions) error {
+	log := velocityMapLog.Named("shard")
+
+	for {
+		var src *source
+
+		select {
+		case s, ok := <-sources:
+			if !ok {
+				return nil
+			}
+			src = s
+		case <-ctx.Done():
+			log.Debug("context done")
+			return nil
+		}
+
+		result := decodeFile(src, opts.dedup)
+		if result.err != nil && opts.failFast {
+			return fmt.Errorf("%s: %s", result.name, result.err)
+		}
+
+		unique := result.err != nil || seen.claim(result.hash, result.notesHash)
+
+		sh.Lock()
+		sh.state.add(result, unique, opts.filter)
+		sh.Unlock()
+
+		opts.progress.scanned(result.err != nil)
+	}
+}
+
+// snapshot merges the shards into a copy of base without stopping them.
+func snapshot(base *scanState, shards []*shard) *scanState {
+	state := newScanState()
+	state.keys = base.keys
+	state.merge(base)
+
+	for _, sh := range shards {
+		sh.Lock()
+		state.merge(sh.state)
+		sh.Unlock()
+	}
+
+	return state
+}
+
+// skipCompleted drops the sources a resumed scan has already processed.
+func skipCompleted(ctx context.Context, sources <-chan *source, completed map[string]bool) <-chan *source {
+	out := make(chan *source)
+
+	go func() {
+		defer close(out)
+
+		for src := range sources {
+			if completed[src.name] {
+				continue
+			}
+
+			select {
+			case out <- src:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+func newVelocityMap(parent context.Context, sources <-chan *source, opts *scanOptions) (noteMap, *scanStats, error) {
 	log := velocityMapLog.Named("newVelocityMap")
 	ctx, cancel := context.WithCancel(parent)
-	results, done := decodeWorker(ctx, paths, cntRoutines)
+	defer cancel()
+
+	// the caller drops the sources a resumed scan has completed, before they
+	// are counted for the progress
+	base := opts.resume
+	if base == nil {
+		base = newScanState()
+		base.keys = opts.keys
+	}
+
+	seen := &hashSet{m: make(map[string]bool, len(base.seen))}
+	for hash := range base.seen {
+		seen.m[hash] = true
+	}
+
+	var wg sync.WaitGroup
+	shards := make([]*shard, opts.routines)
+	errs := make(chan error, opts.routines)
+
+	for i := range shards {
+		shards[i] = &shard{state: newScanState()}
+
+		wg.Add(1)
+		go func(sh *shard) {
+			defer wg.Done()
+			if err := sh.run(ctx, sources, seen, opts); err != nil {
+				errs <- err
+			}
+		}(shards[i])
+	}
 
-	defer func() {
-		log.Debug("cancel")
-		cancel()
-		<-done // wait decodeWorker closed
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
 	}()
 
-	m := make(noteMap)
+	var tick <-chan time.Time
+	if opts.checkpoint != "" && opts.checkpointEvery > 0 {
+		ticker := time.NewTicker(opts.checkpointEvery)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	var err error
 
-	for result := range results {
-		if result.err != nil {
-			return nil, result.err
+loop:
+	for {
+		select {
+		case <-done:
+			break loop
+		case err = <-errs:
+			log.Debug("cancel", zap.Error(err))
+			cancel()
+			<-done
+			break loop
+		case <-tick:
+			log.Debug("checkpoint")
+			if err := writeCheckpoint(opts.checkpoint, snapshot(base, shards)); err != nil {
+				cancel()
+				<-done
+				return nil, nil, err
+			}
+		}
+	}
+
+	state := snapshot(base, shards)
+	sort.Slice(state.stats.failures, func(i, j int) bool {
+		return state.stats.failures[i].Path < state.stats.failures[j].Path
+	})
+	sort.Slice(state.stats.excluded, func(i, j int) bool {
+		a, b := state.stats.excluded[i], state.stats.excluded[j]
+		if a.Path != b.Path {
+			return a.Path < b.Path
 		}
+		return a.Track < b.Track
+	})
 
-		log.Debug("result", zap.String("name", result.name), zap.Int("tracks", len(result.tracks)))
+	if err == nil && parent.Err() != nil {
+		err = errInterrupted
+	}
 
+	if err != nil {
+		if opts.checkpoint != "" {
+			if cErr := writeCheckpoint(opts.checkpoint, state); cErr != nil {
+				return nil, nil, fmt.Errorf("%s, checkpoint: %s", err, cErr)
+			}
+		}
+		return nil, nil, err
+	}
+
+	return state.notes, state.stats, nil
+}
+
+func (state *scanState) add(result *result, unique bool, filter *corpusFilter) {
+	log := velocityMapLog.Named("add")
+
+	state.stats.files++
+	state.completed[result.name] = true
+
+	if result.err != nil {
+		log.Debug("failed", zap.String("name", result.name), zap.Error(result.err))
+		state.stats.failures = append(state.stats.failures, newFailure(result))
+		return
+	}
+
+	if !unique {
+		log.Debug("duplicate", zap.String("name", result.name))
+		state.stats.duplicates++
+		return
+	}
+
+	// the hashes go along with the notes, so a checkpoint never has one without the other
+	for _, hash := range []string{result.hash, result.notesHash} {
+		if hash != "" {
+			state.seen[hash] = true
+		}
+	}
+
+	log.Debug("result", zap.String("name", result.name), zap.Int("tracks", len(result.tracks)))
+
+	state.stats.tracks += len(result.tracks)
+
+	if reason := filter.file(result); reason != "" {
+		log.Debug("skip", zap.String("name", result.name), zap.String("reason", reason))
 		for _, track := range result.tracks {
+			state.stats.skip(reason, countNotes(track.Events))
+		}
+		return
+	}
 
-			for _, event := range track.Events {
-				if event.Velocity == 0 {
-					continue
-				}
+	for i := range result.tracks {
+		state.addTrack(result, i, filter)
+	}
+}
+
+// countNotes counts the events that carry a velocity.
+func countNotes(events []*midi.Event) int {
+	n := 0
+	for _, event := range events {
+		if event.Velocity != 0 {
+			n++
+		}
+	}
+	return n
+}
+
+func (state *scanState) addTrack(result *result, i int, filter *corpusFilter) {
+	log := velocityMapLog.Named("addTrack")
+	track := result.tracks[i]
+
+	if reason := filter.track(track); reason != "" {
+		state.stats.skip(reason, countNotes(track.Events))
+		return
+	}
+
+	events := make([]*midi.Event, 0, len(track.Events))
+	keys := make([]string, 0, len(track.Events))
+	for _, event := range track.Events {
+		if event.Velocity == 0 {
+			state.stats.skip(skipZeroVelocity, 1)
+			continue
+		}
+
+		if reason := filter.event(event); reason != "" {
+			state.stats.skip(reason, 1)
+			continue
+		}
 
-				log.Debug("event", zap.Uint8("note", event.Note), zap.Int("position", event.QuarterPosition))
+		key, ok := filter.key(event)
+		if !ok {
+			state.stats.skip(skipUnmapped, 1)
+			continue
+		}
 
-				if _, ok := m[event.Note]; ok { // check type
-					if _, ok := m[event.Note][event.MsgType]; ok { // check position
-						if _, ok := m[event.Note][event.MsgType][event.QuarterPosition]; ok { // check Velocity
-							m[event.Note][event.MsgType][event.QuarterPosition][event.Velocity] = true
-						} else {
-							velocity := make(velocityMap)
-							velocity[event.Velocity] = true
+		events = append(events, event)
+		keys = append(keys, key)
+	}
 
-							m[event.Note][event.MsgType][event.QuarterPosition] = velocity
-						}
-					} else {
-						velocity := make(velocityMap)
-						velocity[event.Velocity] = true
+	if filter.minNotes > 0 && countNoteOn(events) < filter.minNotes {
+		state.stats.skip(skipFewNotes, len(events))
+		return
+	}
 
-						position := make(positionMap)
-						position[event.QuarterPosition] = velocity
+	if filter.humanness.enabled() && len(events) > 0 {
+		h := measureHumanness(events, result.ticks)
+		if reasons := filter.humanness.check(h, result.ticks); len(reasons) > 0 {
+			log.Debug("not human", zap.String("name", result.name), zap.Int("track", i), zap.Strings("reasons", reasons))
+			state.stats.skip(skipNotHuman, len(events))
+			state.stats.excluded = append(state.stats.excluded, exclusion{
+				Path:    result.name,
+				Track:   i,
+				Name:    track.Name,
+				Reasons: reasons,
+				Metrics: h,
+			})
+			return
+		}
+	}
 
-						m[event.Note][event.MsgType] = position
-					}
-				} else {
-					velocity := make(velocityMap)
-					velocity[event.Velocity] = true
+	kept := make(map[*midi.Event]string, len(events))
+	history := database.NewHistory()
+	for j, event := range events {
+		kept[event] = keys[j]
+		log.Debug("event", zap.String("key", keys[j]), zap.Int("position", event.QuarterPosition))
 
-					position := make(positionMap)
-					position[event.QuarterPosition] = velocity
+		state.notes.add(keys[j], event.MsgType, event.QuarterPosition, int(event.Velocity), 1)
+		state.stats.notes++
 
-					msgType := make(typeMap)
-					msgType[event.MsgType] = position
+		// files in SMPTE time have no grid to compare with
+		if event.MsgType == database.NoteOn && result.ticks > 0 {
+			position, offset := gridOffset(event.AbsTicks, result.ticks)
+			state.notes.add(keys[j], database.Timing, position, offset, 1)
+		}
 
-					m[event.Note] = msgType
+		if event.MsgType == database.NoteOn {
+			for _, msgType := range []uint8{database.Transition, database.Transition2, database.CrossTransition} {
+				if context, ok := history.Context(msgType, keys[j]); ok {
+					state.notes.add(keys[j], msgType, context, int(event.Velocity), 1)
 				}
 			}
+			history.Add(keys[j], int(event.Velocity))
 		}
 	}
 
-	return m, nil
+	if result.ticks == 0 {
+		return
+	}
+	addHands(state.notes, events, keys, filter, result.ticks)
+	addChords(state.notes, events, keys, filter.chordWindow, result.ticks)
+
+	// the events that end notes are paired on the whole track, a Note On
+	// with velocity 0 is not among the events kept
+	for _, n := range track.Notes() {
+		key, ok := kept[n.On]
+		if !ok || n.Off == nil {
+			continue
+		}
+		if length := noteLength(n, result.ticks); length > 0 {
+			state.notes.add(key, database.Length, n.On.QuarterPosition, length, 1)
+		}
+	}
+}
+
+func countNoteOn(events []*midi.Event) int {
+	n := 0
+	for _, event := range events {
+		if event.MsgType == 0x9 && event.Velocity != 0 {
+			n++
+		}
+	}
+	return n
 }
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/Garik-/humanize/pkg/database"
+	"github.com/Garik-/humanize/pkg/drummap"
+	"io/ioutil"
+	"testing"
+)
+
+// benchmarkFiles is the number of files a scan of the benchmark reads, all
+// copies of one file held in memory so the disk does not set the pace.
+const benchmarkFiles = 2000
+
+// BenchmarkVelocityMap scans the same files with 1 to 8 workers, -cpu sets the
+// cores they may use:
+//
+//	go test ./cmd/scan -run - -bench VelocityMap -cpu 1,2,4,8
+func BenchmarkVelocityMap(b *testing.B) {
+	data, err := ioutil.ReadFile("../../pkg/midi/test.mid")
+	if err != nil {
+		b.Fatal(err)
+	}
+	dbMap, err := drummap.Load("gm")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, routines := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("p%d", routines), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				sources := make(chan *source)
+				go func() {
+					defer close(sources)
+					for j := 0; j < benchmarkFiles; j++ {
+						sources <- &source{name: fmt.Sprintf("%d.mid", j), archived: true, data: data}
+					}
+				}()
+
+				_, stats, err := newVelocityMap(context.Background(), sources, &scanOptions{
+					routines: routines,
+					dedup:    dedupNone,
+					filter:   &corpusFilter{dbMap: dbMap},
+					keys:     database.KeyNotes,
+				})
+				if err != nil {
+					b.Fatal(err)
+				}
+				if stats.files != benchmarkFiles {
+					b.Fatalf("scanned %d files, want %d", stats.files, benchmarkFiles)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,25 @@
+package database
+
+import "strings"
+
+// Chord names the table of the velocities of hits played together. Its keys
+// join the keys of two hits of a group, ChordKey(anchor, member), its
+// positions are the velocity bins of the anchor and its values the velocities
+// of the member.
+const Chord uint8 = 0x17
+
+const chordSeparator = "+"
+
+// ChordKey is the key of the velocities of member when played with anchor.
+func ChordKey(anchor string, member string) string {
+	return anchor + chordSeparator + member
+}
+
+// SplitChordKey returns the keys of the anchor and the member of a chord key.
+func SplitChordKey(key string) (string, string, bool) {
+	i := strings.Index(key, chordSeparator)
+	if i < 0 {
+		return "", "", false
+	}
+	return key[:i], key[i+len(chordSeparator):], true
+}
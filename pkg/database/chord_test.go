@@ -0,0 +1,19 @@
+package database
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestChordKey(t *testing.T) {
+	key := ChordKey("kick", "crash.bow")
+	assert.Equal(t, "kick+crash.bow", key)
+
+	anchor, member, ok := SplitChordKey(key)
+	assert.True(t, ok)
+	assert.Equal(t, "kick", anchor)
+	assert.Equal(t, "crash.bow", member)
+
+	_, _, ok = SplitChordKey("36")
+	assert.False(t, ok)
+}
@@ -0,0 +1,453 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// Version is the schema version written by Write.
+const Version = 3
+
+// MIDI message types the database keeps values for.
+const (
+	NoteOff    uint8 = 0x8
+	NoteOn     uint8 = 0x9
+	Aftertouch uint8 = 0xA
+)
+
+// Timing is not a message type, it names the table of Note On offsets from
+// the grid in ticks at TimingResolution ticks per quarter note.
+const Timing uint8 = 0x10
+
+// Length names the table of note lengths, from Note On to the event that ends
+// the note, in ticks at TimingResolution ticks per quarter note.
+const Length uint8 = 0x11
+
+// HandVelocity and HandTiming name the tables of the hits of hi-hat and ride
+// runs, keyed on the hand that plays them, sticking.Lead or sticking.Other,
+// instead of a position. HandVelocity has the distance of a velocity from
+// the mean velocity of its run, HandTiming the offset from the grid in ticks
+// at TimingResolution ticks per quarter note.
+const (
+	HandVelocity uint8 = 0x15
+	HandTiming   uint8 = 0x16
+)
+
+// TimingResolution is the ticks per quarter note of the Timing and Length
+// tables.
+const TimingResolution = 480
+
+// tableTypes are the tables in the order they are walked.
+var tableTypes = []uint8{NoteOn, NoteOff, Aftertouch, Timing, Length, Transition, Transition2, CrossTransition, HandVelocity, HandTiming, Chord}
+
+// Positional reports whether the positions of the table are positions in the
+// bar, not the contexts of a transition table, the hands of a hand table or
+// the velocity bins of the chord table.
+func Positional(msgType uint8) bool {
+	return !IsTransition(msgType) && msgType != HandVelocity && msgType != HandTiming && msgType != Chord
+}
+
+// PositionsPerBar is the period of the positions, the quarter notes of a 4/4
+// bar: the last one is as near to the first as the second is.
+const PositionsPerBar = 4
+
+// PositionDistance is the number of positions between a and b, across the bar
+// line.
+func PositionDistance(a int, b int) int {
+	d := ((a-b)%PositionsPerBar + PositionsPerBar) % PositionsPerBar
+	if PositionsPerBar-d < d {
+		return PositionsPerBar - d
+	}
+	return d
+}
+
+// What the keys of the tables are.
+const (
+	KeyNotes         = "notes"         // note numbers, "36"
+	KeyArticulations = "articulations" // drum map articulations, "snare.rimshot"
+)
+
+// Histogram counts the samples of each value observed at a position.
+type Histogram map[int]int
+
+// Positions maps a position in the bar to the values observed there.
+type Positions map[int]Histogram
+
+// Table maps a key, a note number or an articulation name, to its positions.
+type Table map[string]Positions
+
+// Database holds Note On velocities, Note Off release velocities and
+// polyphonic aftertouch pressure in separate tables, they are different
+// musical parameters and are only used when asked for.
+//
+// The other tables are named by pseudo message types above 0xF that no MIDI
+// message has, their positions are not always positions in the bar:
+//
+//	0x10 Timing           offsets from the grid by position
+//	0x11 Length           note lengths by position
+//	0x12 Transition       velocities by the bin of the previous hit of the key
+//	0x13 Transition2      velocities by the bins of the two previous hits of the key
+//	0x14 CrossTransition  velocities by the bins of the previous hit of the key and of any other key
+//	0x15 HandVelocity     distances from the mean velocity of a run by hand
+//	0x16 HandTiming       offsets from the grid by hand
+//	0x17 Chord            velocities of a member of a chord by the bin of its anchor
+type Database struct {
+	Version    int    `json:"version"`
+	Keys       string `json:"keys,omitempty"`
+	NoteOn     Table  `json:"noteOn"`
+	NoteOff    Table  `json:"noteOff,omitempty"`
+	Aftertouch Table  `json:"aftertouch,omitempty"`
+	Timing     Table  `json:"timing,omitempty"`
+	Length     Table  `json:"length,omitempty"`
+
+	Transition      Table `json:"transition,omitempty"`
+	Transition2     Table `json:"transition2,omitempty"`
+	CrossTransition Table `json:"crossTransition,omitempty"`
+
+	HandVelocity Table `json:"handVelocity,omitempty"`
+	HandTiming   Table `json:"handTiming,omitempty"`
+
+	Chord Table `json:"chord,omitempty"`
+}
+
+func New() *Database {
+	return &Database{Version: Version, Keys: KeyNotes, NoteOn: make(Table)}
+}
+
+// NoteKey is the key of a note in a database keyed by notes.
+func NoteKey(note uint8) string {
+	return strconv.Itoa(int(note))
+}
+
+// ParseNoteKey returns the note of a key in a database keyed by notes.
+func ParseNoteKey(key string) (uint8, bool) {
+	note, err := strconv.ParseUint(key, 10, 7)
+	return uint8(note), err == nil
+}
+
+// Articulations reports whether the keys are articulation names.
+func (db *Database) Articulations() bool {
+	return db.Keys == KeyArticulations
+}
+
+// Tables returns the tables by message type, leaving out the empty ones.
+func (db *Database) Tables() map[uint8]Table {
+	tables := make(map[uint8]Table)
+	for _, msgType := range tableTypes {
+		if t := db.Table(msgType); len(t) > 0 {
+			tables[msgType] = t
+		}
+	}
+	return tables
+}
+
+// Table returns the table for a message type, nil if the database has none.
+func (db *Database) Table(msgType uint8) Table {
+	if table := db.table(msgType); table != nil {
+		return *table
+	}
+	return nil
+}
+
+func (db *Database) table(msgType uint8) *Table {
+	switch msgType {
+	case NoteOn:
+		return &db.NoteOn
+	case NoteOff:
+		return &db.NoteOff
+	case Aftertouch:
+		return &db.Aftertouch
+	case Timing:
+		return &db.Timing
+	case Length:
+		return &db.Length
+	case Transition:
+		return &db.Transition
+	case Transition2:
+		return &db.Transition2
+	case CrossTransition:
+		return &db.CrossTransition
+	case HandVelocity:
+		return &db.HandVelocity
+	case HandTiming:
+		return &db.HandTiming
+	case Chord:
+		return &db.Chord
+	}
+	return nil
+}
+
+// Add records a sample of a value.
+func (db *Database) Add(msgType uint8, key string, position int, value int) {
+	db.AddSamples(msgType, key, position, value, 1)
+}
+
+// AddSamples records n samples of a value.
+func (db *Database) AddSamples(msgType uint8, key string, position int, value int, n int) {
+	table := db.table(msgType)
+	if table == nil {
+		return
+	}
+
+	if *table == nil {
+		*table = make(Table)
+	}
+	(*table).add(key, position, value, n)
+}
+
+// Set replaces the values of a key at a position like Table.Set, the table is
+// created when the database has none.
+func (db *Database) Set(msgType uint8, key string, position int, values []int) {
+	table := db.table(msgType)
+	if table == nil {
+		return
+	}
+
+	if *table == nil {
+		*table = make(Table)
+	}
+	(*table).Set(key, position, values)
+}
+
+func (t Table) add(key string, position int, value int, n int) {
+	if n <= 0 {
+		return
+	}
+
+	positions, ok := t[key]
+	if !ok {
+		positions = make(Positions)
+		t[key] = positions
+	}
+
+	h, ok := positions[position]
+	if !ok {
+		h = make(Histogram)
+		positions[position] = h
+	}
+	h[value] += n
+}
+
+// Sorted returns the positions in ascending order.
+func (p Positions) Sorted() []int {
+	positions := make([]int, 0, len(p))
+	for position := range p {
+		positions = append(positions, position)
+	}
+	sort.Ints(positions)
+	return positions
+}
+
+// Values returns the distinct values in ascending order.
+func (h Histogram) Values() []int {
+	values := make([]int, 0, len(h))
+	for value, n := range h {
+		if n > 0 {
+			values = append(values, value)
+		}
+	}
+	sort.Ints(values)
+	return values
+}
+
+// Samples returns the number of samples of all values.
+func (h Histogram) Samples() int {
+	n := 0
+	for _, count := range h {
+		n += count
+	}
+	return n
+}
+
+// Merge adds the samples of other.
+func (h Histogram) Merge(other Histogram) {
+	for value, n := range other {
+		h[value] += n
+	}
+}
+
+// Lookup returns the distinct values observed for a key at a position.
+func (t Table) Lookup(key string, position int) ([]int, bool) {
+	values := t[key][position].Values()
+	return values, len(values) > 0
+}
+
+// Set replaces the values of a key at a position, each value is one sample.
+func (t Table) Set(key string, position int, values []int) {
+	if positions, ok := t[key]; ok {
+		delete(positions, position)
+	}
+	for _, value := range values {
+		t.add(key, position, value, 1)
+	}
+}
+
+// Rename moves the positions of a key to another one, the values of a
+// position both keys have are merged.
+func (t Table) Rename(from string, to string) bool {
+	positions, ok := t[from]
+	if !ok {
+		return false
+	}
+	if from == to {
+		return true
+	}
+
+	delete(t, from)
+	for position, h := range positions {
+		for value, n := range h {
+			t.add(to, position, value, n)
+		}
+	}
+	return true
+}
+
+// Keys returns the keys of the table, note numbers in numeric order first.
+func (t Table) Keys() []string {
+	keys := make([]string, 0, len(t))
+	for key := range t {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, aNote := ParseNoteKey(keys[i])
+		b, bNote := ParseNoteKey(keys[j])
+		if aNote && bNote {
+			return a < b
+		}
+		if aNote != bNote {
+			return aNote
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
+// legacy is the first schema: note -> message type -> position -> values.
+type legacy map[uint8]map[uint8]map[int][]int
+
+// listed is the second schema, it kept the distinct values of a position
+// without their number of samples.
+type listed struct {
+	Keys       string                   `json:"keys"`
+	NoteOn     map[string]map[int][]int `json:"noteOn"`
+	NoteOff    map[string]map[int][]int `json:"noteOff"`
+	Aftertouch map[string]map[int][]int `json:"aftertouch"`
+}
+
+// Load reads a database, including the unversioned schema where the message
+// types share one table and the second one without sample counts. The values
+// of the older schemas count as one sample each.
+func Load(r io.Reader) (*Database, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var probe struct {
+		Version int `json:"version"`
+	}
+	if err = json.Unmarshal(data, &probe); err != nil {
+		return nil, err
+	}
+
+	if probe.Version == 0 {
+		var old legacy
+		if err = json.Unmarshal(data, &old); err != nil {
+			return nil, err
+		}
+		return fromLegacy(old), nil
+	}
+
+	if probe.Version == 2 {
+		var old listed
+		if err = json.Unmarshal(data, &old); err != nil {
+			return nil, err
+		}
+		return fromListed(old), nil
+	}
+
+	if probe.Version > Version {
+		return nil, fmt.Errorf("database version %d is newer than supported %d", probe.Version, Version)
+	}
+
+	db := New()
+	if err = json.Unmarshal(data, db); err != nil {
+		return nil, err
+	}
+	if db.NoteOn == nil {
+		db.NoteOn = make(Table)
+	}
+	if db.Keys == "" {
+		db.Keys = KeyNotes
+	}
+	return db, nil
+}
+
+func fromLegacy(old legacy) *Database {
+	db := New()
+	for note, types := range old {
+		for msgType, positions := range types {
+			for position, values := range positions {
+				for _, value := range values {
+					db.Add(msgType, NoteKey(note), position, value)
+				}
+			}
+		}
+	}
+	return db
+}
+
+func fromListed(old listed) *Database {
+	db := New()
+	if old.Keys != "" {
+		db.Keys = old.Keys
+	}
+	for msgType, table := range map[uint8]map[string]map[int][]int{
+		NoteOn:     old.NoteOn,
+		NoteOff:    old.NoteOff,
+		Aftertouch: old.Aftertouch,
+	} {
+		for key, positions := range table {
+			for position, values := range positions {
+				for _, value := range values {
+					db.Add(msgType, key, position, value)
+				}
+			}
+		}
+	}
+	return db
+}
+
+// Write encodes the database as json.
+func (db *Database) Write(w io.Writer) error {
+	db.Version = Version
+	return json.NewEncoder(w).Encode(db)
+}
+
+// WriteFile replaces the file atomically, a failed or interrupted write
+// leaves the previous database intact.
+func (db *Database) WriteFile(name string) error {
+	tmp := name + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	if err = db.Write(f); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+
+	if err = f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return os.Rename(tmp, name)
+}
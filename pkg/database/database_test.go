@@ -0,0 +1,168 @@
+package database
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoad_Legacy(t *testing.T) {
+	db, err := Load(strings.NewReader(`{"0":{"10":{"0":[127]}},"1":{"9":{"0":[61,50,50]},"8":{"2":[64]}}}`))
+	require.NoError(t, err)
+
+	assert.Equal(t, Table{"1": {0: {50: 2, 61: 1}}}, db.NoteOn)
+	assert.Equal(t, Table{"1": {2: {64: 1}}}, db.NoteOff)
+	assert.Equal(t, Table{"0": {0: {127: 1}}}, db.Aftertouch)
+	assert.False(t, db.Articulations())
+
+	values, ok := db.Table(NoteOn).Lookup("1", 0)
+	assert.True(t, ok)
+	assert.Equal(t, []int{50, 61}, values)
+
+	_, ok = db.Table(NoteOn).Lookup("1", 1)
+	assert.False(t, ok)
+}
+
+func TestLoad_Listed(t *testing.T) {
+	db, err := Load(strings.NewReader(`{"version":2,"keys":"articulations","noteOn":{"kick":{"0":[90,100]}},"noteOff":{"kick":{"1":[64]}}}`))
+	require.NoError(t, err)
+
+	assert.True(t, db.Articulations())
+	assert.Equal(t, Table{"kick": {0: {90: 1, 100: 1}}}, db.NoteOn)
+	assert.Equal(t, Table{"kick": {1: {64: 1}}}, db.NoteOff)
+	assert.Equal(t, Version, db.Version)
+}
+
+func TestLoad_Repository(t *testing.T) {
+	f, err := os.Open("../../database/drums.json")
+	require.NoError(t, err)
+	defer f.Close()
+
+	db, err := Load(f)
+	require.NoError(t, err)
+	assert.NotEmpty(t, db.NoteOn)
+}
+
+func TestWrite(t *testing.T) {
+	db := New()
+	db.Add(NoteOn, "36", 0, 100)
+	db.Add(NoteOn, "36", 0, 90)
+	db.Add(NoteOn, "36", 0, 100)
+
+	var buf bytes.Buffer
+	require.NoError(t, db.Write(&buf))
+	assert.Equal(t, `{"version":3,"keys":"notes","noteOn":{"36":{"0":{"100":2,"90":1}}}}`+"\n", buf.String())
+
+	loaded, err := Load(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, db, loaded)
+}
+
+func TestWriteFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "database")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "drums.json")
+	require.NoError(t, ioutil.WriteFile(name, []byte("previous"), 0644))
+
+	db := New()
+	db.Add(NoteOn, "36", 0, 100)
+	require.NoError(t, db.WriteFile(name))
+
+	f, err := os.Open(name)
+	require.NoError(t, err)
+	defer f.Close()
+	loaded, err := Load(f)
+	require.NoError(t, err)
+	assert.Equal(t, db, loaded)
+
+	_, err = os.Stat(name + ".tmp")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestWrite_Timing(t *testing.T) {
+	db := New()
+	db.Add(Timing, "38", 1, -12)
+	db.Add(Timing, "38", 1, 4)
+
+	var buf bytes.Buffer
+	require.NoError(t, db.Write(&buf))
+
+	loaded, err := Load(&buf)
+	require.NoError(t, err)
+	values, ok := loaded.Table(Timing).Lookup("38", 1)
+	assert.True(t, ok)
+	assert.Equal(t, []int{-12, 4}, values)
+}
+
+func TestWrite_Length(t *testing.T) {
+	db := New()
+	db.AddSamples(Length, "49", 0, 960, 3)
+
+	var buf bytes.Buffer
+	require.NoError(t, db.Write(&buf))
+	assert.Contains(t, buf.String(), `"length":{"49":{"0":{"960":3}}}`)
+
+	loaded, err := Load(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, Histogram{960: 3}, loaded.Table(Length)["49"][0])
+}
+
+func TestTable(t *testing.T) {
+	table := Table{}
+	table.Set("snare.center", 1, []int{80, 70, 80})
+	table.Set("36", 0, []int{100})
+	table.Set("4", 0, []int{50})
+
+	values, ok := table.Lookup("snare.center", 1)
+	assert.True(t, ok)
+	assert.Equal(t, []int{70, 80}, values)
+
+	assert.Equal(t, 3, table["snare.center"][1].Samples())
+
+	table.Set("snare.center", 1, []int{60})
+	values, _ = table.Lookup("snare.center", 1)
+	assert.Equal(t, []int{60}, values)
+
+	assert.Equal(t, []string{"4", "36", "snare.center"}, table.Keys())
+}
+
+func TestDatabase_Set(t *testing.T) {
+	db := New()
+	db.Set(Chord, "36+49", 6, []int{20, 25})
+	assert.Equal(t, Table{"36+49": {6: {20: 1, 25: 1}}}, db.Chord)
+
+	db.Set(Chord, "36+49", 6, []int{30})
+	assert.Equal(t, Table{"36+49": {6: {30: 1}}}, db.Chord)
+}
+
+func TestTable_Rename(t *testing.T) {
+	table := Table{
+		"37": {0: {40: 1, 60: 2}},
+		"38": {0: {50: 1, 60: 1}, 1: {70: 1}},
+	}
+
+	assert.True(t, table.Rename("37", "38"))
+	assert.Equal(t, Table{"38": {0: {40: 1, 50: 1, 60: 3}, 1: {70: 1}}}, table)
+
+	assert.False(t, table.Rename("37", "38"))
+}
+
+func TestPositionDistance(t *testing.T) {
+	assert.Equal(t, 0, PositionDistance(2, 2))
+	assert.Equal(t, 1, PositionDistance(0, 1))
+	assert.Equal(t, 1, PositionDistance(0, 3))
+	assert.Equal(t, 2, PositionDistance(3, 1))
+	assert.Equal(t, 1, PositionDistance(-1, 0))
+}
+
+func TestPositions_Sorted(t *testing.T) {
+	assert.Equal(t, []int{-5, 0, 3}, Positions{3: {}, -5: {}, 0: {}}.Sorted())
+	assert.Empty(t, Positions{}.Sorted())
+}
@@ -0,0 +1,151 @@
+package database
+
+// PruneOptions says which entries, the values of a key at a position, are
+// removed from a database.
+type PruneOptions struct {
+	// MinSamples drops the entries with fewer samples.
+	MinSamples int
+	// Merge moves the samples of such entries to the nearest position of the
+	// same key that has enough samples instead of dropping them. The contexts
+	// of the transition tables, the hands of the hand tables and the bins of
+	// the chord table are not near each other, their entries are always
+	// dropped.
+	Merge bool
+	// Percentile removes the values of an entry below this percentile and
+	// above 100 minus it, 0 keeps all values.
+	Percentile float64
+}
+
+// Entry is the values of a key at a position.
+type Entry struct {
+	MsgType  uint8  `json:"type"`
+	Key      string `json:"key"`
+	Position int    `json:"position"`
+	Samples  int    `json:"samples"`
+	Into     *int   `json:"into,omitempty"` // the position a merged entry was moved to
+}
+
+// Stats counts the contents of a database.
+type Stats struct {
+	Keys    int `json:"keys"`
+	Entries int `json:"entries"`
+	Values  int `json:"values"`
+	Samples int `json:"samples"`
+}
+
+// PruneReport is the effect of Prune.
+type PruneReport struct {
+	Before   Stats   `json:"before"`
+	After    Stats   `json:"after"`
+	Dropped  []Entry `json:"dropped"`
+	Merged   []Entry `json:"merged"`
+	Outliers int     `json:"outliers"` // samples removed by the percentile
+}
+
+// Stats counts the keys, entries, distinct values and samples of all tables.
+func (db *Database) Stats() Stats {
+	var s Stats
+	for _, msgType := range tableTypes {
+		for _, positions := range db.Table(msgType) {
+			s.Keys++
+			for _, h := range positions {
+				s.Entries++
+				s.Values += len(h.Values())
+				s.Samples += h.Samples()
+			}
+		}
+	}
+	return s
+}
+
+// Prune removes the entries with too few samples and the outlying values.
+func (db *Database) Prune(opts PruneOptions) *PruneReport {
+	r := &PruneReport{Before: db.Stats()}
+
+	for _, msgType := range tableTypes {
+		table := db.Table(msgType)
+		for _, key := range table.Keys() {
+			positions := table[key]
+
+			if opts.MinSamples > 0 {
+				r.pruneSparse(msgType, key, positions, opts)
+			}
+			if opts.Percentile > 0 {
+				for _, h := range positions {
+					r.Outliers += h.trim(opts.Percentile)
+				}
+			}
+
+			for position, h := range positions {
+				if h.Samples() == 0 {
+					delete(positions, position)
+				}
+			}
+			if len(positions) == 0 {
+				delete(table, key)
+			}
+		}
+	}
+
+	r.After = db.Stats()
+	return r
+}
+
+func (r *PruneReport) pruneSparse(msgType uint8, key string, positions Positions, opts PruneOptions) {
+	var dense, sparse []int
+	for _, position := range positions.Sorted() {
+		if positions[position].Samples() >= opts.MinSamples {
+			dense = append(dense, position)
+		} else {
+			sparse = append(sparse, position)
+		}
+	}
+
+	for _, position := range sparse {
+		h := positions[position]
+		entry := Entry{MsgType: msgType, Key: key, Position: position, Samples: h.Samples()}
+		delete(positions, position)
+
+		if !opts.Merge || len(dense) == 0 || !Positional(msgType) {
+			r.Dropped = append(r.Dropped, entry)
+			continue
+		}
+
+		into := nearestPosition(dense, positions, position)
+		positions[into].Merge(h)
+		entry.Into = &into
+		r.Merged = append(r.Merged, entry)
+	}
+}
+
+// nearestPosition returns the closest of the positions, of two equally close
+// ones the one with more samples.
+func nearestPosition(candidates []int, positions Positions, position int) int {
+	best := candidates[0]
+	for _, p := range candidates[1:] {
+		d, bestD := PositionDistance(p, position), PositionDistance(best, position)
+		if d < bestD || (d == bestD && positions[p].Samples() > positions[best].Samples()) {
+			best = p
+		}
+	}
+	return best
+}
+
+// trim removes the values whose samples all lie below the percentile or
+// above 100 minus it and returns the number of samples removed. A value
+// that straddles the boundary is kept.
+func (h Histogram) trim(percentile float64) int {
+	total := float64(h.Samples())
+	low, high := total*percentile/100, total*(100-percentile)/100
+
+	removed, below := 0, 0
+	for _, value := range h.Values() {
+		n := h[value]
+		if float64(below+n) <= low || float64(below) >= high {
+			delete(h, value)
+			removed += n
+		}
+		below += n
+	}
+	return removed
+}
@@ -0,0 +1,78 @@
+package database
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPrune_Drop(t *testing.T) {
+	db := New()
+	db.NoteOn = Table{
+		"36": {0: {100: 5}, 1: {127: 1}},
+		"49": {2: {127: 1}},
+	}
+
+	r := db.Prune(PruneOptions{MinSamples: 2})
+
+	assert.Equal(t, Table{"36": {0: {100: 5}}}, db.NoteOn)
+	assert.Equal(t, Stats{Keys: 2, Entries: 3, Values: 3, Samples: 7}, r.Before)
+	assert.Equal(t, Stats{Keys: 1, Entries: 1, Values: 1, Samples: 5}, r.After)
+	assert.Equal(t, []Entry{
+		{MsgType: NoteOn, Key: "36", Position: 1, Samples: 1},
+		{MsgType: NoteOn, Key: "49", Position: 2, Samples: 1},
+	}, r.Dropped)
+	assert.Empty(t, r.Merged)
+}
+
+func TestPrune_Merge(t *testing.T) {
+	db := New()
+	db.NoteOn = Table{
+		"36": {0: {100: 5}, 1: {127: 1}, 3: {90: 3}},
+	}
+
+	r := db.Prune(PruneOptions{MinSamples: 2, Merge: true})
+
+	assert.Equal(t, Table{"36": {0: {100: 5, 127: 1}, 3: {90: 3}}}, db.NoteOn)
+	into := 0
+	assert.Equal(t, []Entry{{MsgType: NoteOn, Key: "36", Position: 1, Samples: 1, Into: &into}}, r.Merged)
+}
+
+func TestPrune_MergeAcrossBarLine(t *testing.T) {
+	db := New()
+	db.NoteOn = Table{
+		"36": {0: {127: 1}, 2: {100: 5}, 3: {90: 3}},
+	}
+
+	r := db.Prune(PruneOptions{MinSamples: 2, Merge: true})
+
+	assert.Equal(t, Table{"36": {2: {100: 5}, 3: {90: 3, 127: 1}}}, db.NoteOn)
+	into := 3
+	assert.Equal(t, []Entry{{MsgType: NoteOn, Key: "36", Position: 0, Samples: 1, Into: &into}}, r.Merged)
+}
+
+func TestPrune_MergeTransition(t *testing.T) {
+	db := New()
+	db.Transition = Table{"42": {2: {60: 5}, 3: {70: 1}}}
+
+	r := db.Prune(PruneOptions{MinSamples: 2, Merge: true})
+
+	assert.Equal(t, Table{"42": {2: {60: 5}}}, db.Transition)
+	assert.Len(t, r.Dropped, 1)
+	assert.Empty(t, r.Merged)
+}
+
+func TestPrune_Percentile(t *testing.T) {
+	h := make(Histogram)
+	for v := 1; v <= 100; v++ {
+		h[v] = 1
+	}
+	db := New()
+	db.NoteOn = Table{"38": {0: h}}
+
+	r := db.Prune(PruneOptions{Percentile: 5})
+
+	assert.Equal(t, 10, r.Outliers)
+	values, _ := db.NoteOn.Lookup("38", 0)
+	assert.Equal(t, 6, values[0])
+	assert.Equal(t, 95, values[len(values)-1])
+}
@@ -0,0 +1,104 @@
+package database
+
+// The transition tables count the Note On velocities of a key that follow the
+// hits before it. Their positions are contexts, the velocity bins of those
+// hits, not positions in the bar.
+const (
+	// Transition is keyed on the bin of the previous hit of the key.
+	Transition uint8 = 0x12
+	// Transition2 is keyed on the bins of the two previous hits of the key,
+	// Context(before previous, previous).
+	Transition2 uint8 = 0x13
+	// CrossTransition is keyed on the bins of the previous hit of the key and
+	// of the previous hit of any other key, Context(own, other).
+	CrossTransition uint8 = 0x14
+)
+
+// VelocityBins is the number of equal bins velocities fall in for contexts.
+const VelocityBins = 8
+
+// IsTransition reports whether the positions of the table are contexts.
+func IsTransition(msgType uint8) bool {
+	return msgType == Transition || msgType == Transition2 || msgType == CrossTransition
+}
+
+// VelocityBin returns the bin of a velocity, 0 to VelocityBins-1.
+func VelocityBin(velocity int) int {
+	if velocity < 0 {
+		return 0
+	}
+	if velocity > 127 {
+		return VelocityBins - 1
+	}
+	return velocity * VelocityBins / 128
+}
+
+// Context combines the bins of velocities into the position of a transition
+// table, the earliest first.
+func Context(velocities ...int) int {
+	context := 0
+	for _, v := range velocities {
+		context = context*VelocityBins + VelocityBin(v)
+	}
+	return context
+}
+
+type hit struct {
+	key      string
+	velocity int
+}
+
+// History follows a sequence of hits, one track, and gives the contexts of
+// the next hit in the transition tables.
+type History struct {
+	own    map[string][]int // the last two velocities of each key, the latest last
+	recent *hit
+	older  *hit // the latest hit of another key than recent
+}
+
+func NewHistory() *History {
+	return &History{own: make(map[string][]int)}
+}
+
+// Context returns the position of the next hit of the key in a transition
+// table, false while the hits it is keyed on are missing.
+func (h *History) Context(msgType uint8, key string) (int, bool) {
+	own := h.own[key]
+
+	switch msgType {
+	case Transition:
+		if len(own) > 0 {
+			return Context(own[len(own)-1]), true
+		}
+	case Transition2:
+		if len(own) > 1 {
+			return Context(own[0], own[1]), true
+		}
+	case CrossTransition:
+		if other := h.other(key); len(own) > 0 && other != nil {
+			return Context(own[len(own)-1], other.velocity), true
+		}
+	}
+	return 0, false
+}
+
+func (h *History) other(key string) *hit {
+	if h.recent != nil && h.recent.key != key {
+		return h.recent
+	}
+	return h.older
+}
+
+// Add records a hit.
+func (h *History) Add(key string, velocity int) {
+	own := append(h.own[key], velocity)
+	if len(own) > 2 {
+		own = own[len(own)-2:]
+	}
+	h.own[key] = own
+
+	if h.recent != nil && h.recent.key != key {
+		h.older = h.recent
+	}
+	h.recent = &hit{key: key, velocity: velocity}
+}
@@ -0,0 +1,46 @@
+package database
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestVelocityBin(t *testing.T) {
+	assert.Equal(t, 0, VelocityBin(0))
+	assert.Equal(t, 0, VelocityBin(15))
+	assert.Equal(t, 1, VelocityBin(16))
+	assert.Equal(t, 7, VelocityBin(127))
+	assert.Equal(t, 7*VelocityBins+1, Context(120, 20))
+}
+
+func TestHistory(t *testing.T) {
+	h := NewHistory()
+
+	_, ok := h.Context(Transition, "42")
+	assert.False(t, ok)
+
+	h.Add("42", 100)
+	context, ok := h.Context(Transition, "42")
+	assert.True(t, ok)
+	assert.Equal(t, Context(100), context)
+	_, ok = h.Context(Transition2, "42")
+	assert.False(t, ok)
+	_, ok = h.Context(CrossTransition, "42")
+	assert.False(t, ok)
+
+	h.Add("36", 120)
+	h.Add("42", 40)
+	h.Add("42", 60)
+
+	context, _ = h.Context(Transition2, "42")
+	assert.Equal(t, Context(40, 60), context)
+
+	// the kick is the previous hit of another key even after two hi-hats
+	context, ok = h.Context(CrossTransition, "42")
+	assert.True(t, ok)
+	assert.Equal(t, Context(60, 120), context)
+
+	context, ok = h.Context(CrossTransition, "36")
+	assert.True(t, ok)
+	assert.Equal(t, Context(120, 60), context)
+}
@@ -0,0 +1,158 @@
+package drummap
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Articulation is a canonical name of a drum sound, parts separated by dots
+// go from the instrument to the way it is played: "hihat.closed.tip".
+type Articulation string
+
+// Family returns the instrument, the first part of the name.
+func (a Articulation) Family() string {
+	s := string(a)
+	if i := strings.Index(s, "."); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
+
+// Parent returns the name without its last part, "" for an instrument.
+func (a Articulation) Parent() Articulation {
+	s := string(a)
+	if i := strings.LastIndex(s, "."); i >= 0 {
+		return Articulation(s[:i])
+	}
+	return ""
+}
+
+// Within reports whether the articulation is the parent or one of its
+// children, "hihat.closed.tip" is within "hihat.closed".
+func (a Articulation) Within(parent Articulation) bool {
+	return a == parent || strings.HasPrefix(string(a), string(parent)+".")
+}
+
+// Map assigns notes of a drum library to articulations. An articulation can
+// sit on several notes, the first one is used when a note is written.
+type Map struct {
+	Name  string                   `json:"name"`
+	Notes map[Articulation][]uint8 `json:"notes"`
+
+	byNote map[uint8]Articulation
+	sorted []Articulation
+}
+
+func newMap(name string, notes map[Articulation][]uint8) *Map {
+	m := &Map{Name: name, Notes: notes}
+	m.index()
+	return m
+}
+
+func (m *Map) index() {
+	m.byNote = make(map[uint8]Articulation)
+	m.sorted = make([]Articulation, 0, len(m.Notes))
+
+	for a := range m.Notes {
+		m.sorted = append(m.sorted, a)
+	}
+	sort.Slice(m.sorted, func(i, j int) bool { return m.sorted[i] < m.sorted[j] })
+
+	for _, a := range m.sorted {
+		for _, note := range m.Notes[a] {
+			if _, ok := m.byNote[note]; !ok {
+				m.byNote[note] = a
+			}
+		}
+	}
+}
+
+// Articulation returns what the note plays in this map.
+func (m *Map) Articulation(note uint8) (Articulation, bool) {
+	a, ok := m.byNote[note]
+	return a, ok
+}
+
+// Note returns the note of an articulation. A library without that exact
+// articulation gets the closest one it has, a missing "snare.rimshot" falls
+// back to another snare articulation and never to a different instrument.
+func (m *Map) Note(a Articulation) (uint8, bool) {
+	if notes := m.Notes[a]; len(notes) > 0 {
+		return notes[0], true
+	}
+
+	for parent := a; parent != ""; parent = parent.Parent() {
+		for _, candidate := range m.sorted {
+			if candidate.Within(parent) && len(m.Notes[candidate]) > 0 {
+				return m.Notes[candidate][0], true
+			}
+		}
+	}
+
+	return 0, false
+}
+
+// Translate maps a note of one library to the note of the same articulation
+// in another.
+func Translate(from *Map, to *Map, note uint8) (uint8, bool) {
+	a, ok := from.Articulation(note)
+	if !ok {
+		return 0, false
+	}
+	return to.Note(a)
+}
+
+// Read decodes a map from json: {"name": "my kit", "notes": {"kick": [36]}}.
+func Read(r io.Reader) (*Map, error) {
+	m := &Map{}
+	if err := json.NewDecoder(r).Decode(m); err != nil {
+		return nil, err
+	}
+
+	for a, notes := range m.Notes {
+		for _, note := range notes {
+			if note > 127 {
+				return nil, fmt.Errorf("%s: note %d out of range", a, note)
+			}
+		}
+	}
+
+	m.index()
+	return m, nil
+}
+
+// Load returns the built-in map with that name or reads a json map file.
+func Load(name string) (*Map, error) {
+	if m, ok := builtin[strings.ToLower(name)]; ok {
+		return m, nil
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown drum map %q, built-in maps are %s", name, strings.Join(Names(), ", "))
+	}
+	defer f.Close()
+
+	m, err := Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", name, err)
+	}
+	if m.Name == "" {
+		m.Name = name
+	}
+	return m, nil
+}
+
+// Names returns the names of the built-in maps.
+func Names() []string {
+	names := make([]string, 0, len(builtin))
+	for name := range builtin {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
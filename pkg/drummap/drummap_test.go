@@ -0,0 +1,60 @@
+package drummap
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestTranslate(t *testing.T) {
+	gm, err := Load("gm")
+	require.NoError(t, err)
+	ad2, err := Load("AD2")
+	require.NoError(t, err)
+
+	note, ok := Translate(ad2, gm, 61)
+	assert.True(t, ok)
+	assert.Equal(t, uint8(42), note)
+
+	note, ok = Translate(gm, ad2, 44)
+	assert.True(t, ok)
+	assert.Equal(t, uint8(60), note)
+
+	// GM has no closed edge, the closest hi-hat articulation is used
+	note, ok = Translate(ad2, gm, 62)
+	assert.True(t, ok)
+	assert.Equal(t, uint8(42), note)
+
+	_, ok = Translate(gm, ad2, 127)
+	assert.False(t, ok)
+}
+
+func TestArticulation(t *testing.T) {
+	assert.Equal(t, "hihat", HihatClosedTip.Family())
+	assert.Equal(t, "kick", Kick.Family())
+	assert.Equal(t, Articulation("hihat.closed"), HihatClosedTip.Parent())
+	assert.Equal(t, Articulation(""), Kick.Parent())
+}
+
+func TestRead(t *testing.T) {
+	m, err := Read(strings.NewReader(`{"name": "kit", "notes": {"kick": [24], "snare.center": [26, 25]}}`))
+	require.NoError(t, err)
+
+	a, ok := m.Articulation(25)
+	assert.True(t, ok)
+	assert.Equal(t, SnareCenter, a)
+
+	note, ok := m.Note(SnareRimshot)
+	assert.True(t, ok)
+	assert.Equal(t, uint8(26), note)
+
+	_, ok = m.Note(Crash1)
+	assert.False(t, ok)
+
+	_, err = Read(strings.NewReader(`{"notes": {"kick": [200]}}`))
+	assert.Error(t, err)
+
+	_, err = Load("no such map")
+	assert.Error(t, err)
+}
@@ -0,0 +1,167 @@
+package drummap
+
+// Canonical articulations shared by the built-in maps.
+const (
+	Kick Articulation = "kick"
+
+	SnareCenter    Articulation = "snare.center"
+	SnareRimshot   Articulation = "snare.rimshot"
+	SnareSidestick Articulation = "snare.sidestick"
+	SnareEdge      Articulation = "snare.edge"
+
+	HihatClosedTip  Articulation = "hihat.closed.tip"
+	HihatClosedEdge Articulation = "hihat.closed.edge"
+	HihatOpen       Articulation = "hihat.open"
+	HihatPedal      Articulation = "hihat.pedal"
+	HihatSplash     Articulation = "hihat.splash"
+
+	TomHigh     Articulation = "tom.high"
+	TomMid      Articulation = "tom.mid"
+	TomLow      Articulation = "tom.low"
+	TomFloor    Articulation = "tom.floor"
+	TomFloorLow Articulation = "tom.floor.low"
+
+	Crash1 Articulation = "crash.1"
+	Crash2 Articulation = "crash.2"
+	China  Articulation = "china"
+	Splash Articulation = "splash"
+
+	RideTip  Articulation = "ride.tip"
+	RideBell Articulation = "ride.bell"
+	RideEdge Articulation = "ride.edge"
+
+	Clap       Articulation = "clap"
+	Tambourine Articulation = "tambourine"
+	Cowbell    Articulation = "cowbell"
+)
+
+// The library maps follow the factory default note layouts of the products,
+// kits and later versions may move articulations around. A map can be
+// corrected by loading a json file instead.
+var builtin = map[string]*Map{
+	"gm": newMap("General MIDI", map[Articulation][]uint8{
+		Kick:           {36, 35},
+		SnareCenter:    {38},
+		SnareRimshot:   {40},
+		SnareSidestick: {37},
+		HihatClosedTip: {42},
+		HihatOpen:      {46},
+		HihatPedal:     {44},
+		TomHigh:        {50},
+		TomMid:         {48, 47},
+		TomLow:         {45},
+		TomFloor:       {43},
+		TomFloorLow:    {41},
+		Crash1:         {49},
+		Crash2:         {57},
+		China:          {52},
+		Splash:         {55},
+		RideTip:        {51, 59},
+		RideBell:       {53},
+		Clap:           {39},
+		Tambourine:     {54},
+		Cowbell:        {56},
+	}),
+
+	"sd3": newMap("Superior Drummer 3", map[Articulation][]uint8{
+		Kick:            {36, 35},
+		SnareCenter:     {38},
+		SnareRimshot:    {40},
+		SnareSidestick:  {37},
+		SnareEdge:       {33},
+		HihatClosedTip:  {42},
+		HihatClosedEdge: {22},
+		HihatOpen:       {26, 46},
+		HihatPedal:      {44},
+		HihatSplash:     {21},
+		TomHigh:         {48},
+		TomMid:          {47},
+		TomLow:          {45},
+		TomFloor:        {43},
+		TomFloorLow:     {41},
+		Crash1:          {49},
+		Crash2:          {57},
+		China:           {52},
+		Splash:          {55},
+		RideTip:         {51},
+		RideBell:        {53},
+		RideEdge:        {59},
+		Tambourine:      {54},
+		Cowbell:         {56},
+	}),
+
+	"ezd2": newMap("EZdrummer 2", map[Articulation][]uint8{
+		Kick:            {36},
+		SnareCenter:     {38},
+		SnareRimshot:    {40},
+		SnareSidestick:  {37},
+		HihatClosedTip:  {42},
+		HihatClosedEdge: {22},
+		HihatOpen:       {26, 46},
+		HihatPedal:      {44},
+		HihatSplash:     {21},
+		TomHigh:         {48},
+		TomMid:          {47},
+		TomLow:          {45},
+		TomFloor:        {43},
+		TomFloorLow:     {41},
+		Crash1:          {49},
+		Crash2:          {57},
+		China:           {52},
+		Splash:          {55},
+		RideTip:         {51},
+		RideBell:        {53},
+		RideEdge:        {59},
+		Tambourine:      {54},
+		Cowbell:         {56},
+	}),
+
+	"ad2": newMap("Addictive Drums 2", map[Articulation][]uint8{
+		Kick:            {36},
+		SnareCenter:     {38},
+		SnareRimshot:    {40},
+		SnareSidestick:  {37},
+		SnareEdge:       {39},
+		HihatClosedTip:  {61},
+		HihatClosedEdge: {62},
+		HihatOpen:       {65, 66, 67},
+		HihatPedal:      {60},
+		HihatSplash:     {68},
+		TomHigh:         {48},
+		TomMid:          {47},
+		TomLow:          {45},
+		TomFloor:        {43},
+		TomFloorLow:     {41},
+		Crash1:          {77, 49},
+		Crash2:          {79, 57},
+		China:           {52},
+		Splash:          {55},
+		RideTip:         {51},
+		RideBell:        {53},
+		RideEdge:        {59},
+	}),
+
+	"ssd5": newMap("Steven Slate Drums 5", map[Articulation][]uint8{
+		Kick:            {36, 35},
+		SnareCenter:     {38},
+		SnareRimshot:    {40},
+		SnareSidestick:  {37},
+		SnareEdge:       {39},
+		HihatClosedTip:  {42},
+		HihatClosedEdge: {22},
+		HihatOpen:       {46},
+		HihatPedal:      {44},
+		TomHigh:         {48},
+		TomMid:          {47},
+		TomLow:          {45},
+		TomFloor:        {43},
+		TomFloorLow:     {41},
+		Crash1:          {49},
+		Crash2:          {57},
+		China:           {52},
+		Splash:          {55},
+		RideTip:         {51},
+		RideBell:        {53},
+		RideEdge:        {59},
+	}),
+}
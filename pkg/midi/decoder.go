@@ -7,13 +7,6 @@ import (
 	"io"
 )
 
-type nextChunkType int
-
-const (
-	eventChunk nextChunkType = iota + 1
-	trackChunk
-)
-
 type timeFormat int
 
 const (
@@ -32,11 +25,12 @@ var (
 )
 
 type Event struct {
-	absTicks  int64
 	timeDelta uint32
 
+	AbsTicks           int64
 	QuarterPosition    int
 	MsgType            uint8
+	Channel            uint8
 	Note               uint8
 	Velocity           uint8
 	VelocityByteOffset int64
@@ -44,18 +38,58 @@ type Event struct {
 
 type Track struct {
 	Events    []*Event
+	Messages  []*Message // every message of the track, kept when Decoder.KeepMessages is set
+	Name      string
 	timeDelta int64
 }
 
+// Message is a complete message of a track as it is written back by the
+// Encoder. A Note On, Note Off or aftertouch message points at its Event and
+// is written from it, changes to the Event end up in the file.
+type Message struct {
+	AbsTicks int64
+	Status   byte   // running status resolved
+	Data     []byte // the bytes after the status byte
+	Event    *Event
+}
+
+// Tempo is a Set Tempo meta event.
+type Tempo struct {
+	AbsTicks               int64
+	MicrosecondsPerQuarter uint32
+}
+
+// BPM returns the tempo in quarter notes per minute.
+func (t Tempo) BPM() float64 {
+	return 60000000 / float64(t.MicrosecondsPerQuarter)
+}
+
+// TimeSignature is a Time Signature meta event, Denominator is the note value
+// itself, 4 for 3/4.
+type TimeSignature struct {
+	AbsTicks    int64
+	Numerator   uint8
+	Denominator uint8
+}
+
 type Decoder struct {
 	r            io.ReadSeeker
 	lastEvent    *Event
 	currentTrack *Track
+	trackEnd     int64
 	offset       int64
 
+	// KeepMessages makes Decode keep every message in Track.Messages, which
+	// re-encoding the file needs.
+	KeepMessages bool
+
+	Format              uint16
+	Division            uint16
 	TicksPerQuarterNote uint16
 	TimeFormat          timeFormat
 	Tracks              []*Track
+	Tempos              []Tempo
+	TimeSignatures      []TimeSignature
 }
 
 func (d *Decoder) Decode() error {
@@ -65,6 +99,9 @@ func (d *Decoder) Decode() error {
 
 	var code [4]byte
 	d.offset = 0
+	d.Tracks = nil
+	d.Tempos = nil
+	d.TimeSignatures = nil
 
 	if err := binary.Read(d.r, binary.BigEndian, &code); err != nil {
 		return err
@@ -85,6 +122,10 @@ func (d *Decoder) Decode() error {
 		return fmt.Errorf("%s - expected header size to be 6, was %d", ErrFmtNotSupported, headerSize)
 	}
 
+	if err := binary.Read(d.r, binary.BigEndian, &d.Format); err != nil {
+		return err
+	}
+
 	d.offset += 4 + 2 + 2 // uint32 headerSize + uint16 Format + uint16 NumTracks
 
 	if _, err := d.r.Seek(d.offset, io.SeekStart); err != nil {
@@ -96,6 +137,9 @@ func (d *Decoder) Decode() error {
 		return err
 	}
 
+	d.offset += 2 // uint16 division
+	d.Division = division
+
 	if (division & 0x8000) == 0 {
 		d.TicksPerQuarterNote = division & 0x7FFF
 		d.TimeFormat = MetricalTF
@@ -103,168 +147,273 @@ func (d *Decoder) Decode() error {
 		d.TimeFormat = TimeCodeTF
 	}
 
-	nextChunk, err := d.parseTrack()
-	if err != nil {
-		return err
-	}
+	var err error
 
-	for err != io.EOF {
-		switch nextChunk {
-		case eventChunk:
-			nextChunk, err = d.parseEvent()
-		case trackChunk:
-			nextChunk, err = d.parseTrack()
+	// the file ends cleanly after the last chunk, a chunk shorter than its
+	// declared length is truncated, the tracks decoded up to there are kept
+tracks:
+	for {
+		if err = d.parseTrack(); err != nil {
+			break
 		}
 
-		if err != nil && err != io.EOF {
-			return err
+		for d.offset < d.trackEnd {
+			if err = d.parseEvent(); err != nil {
+				if err == io.EOF {
+					err = io.ErrUnexpectedEOF
+				}
+				break tracks
+			}
+		}
+
+		d.offset = d.trackEnd
+		if _, err = d.r.Seek(d.offset, io.SeekStart); err != nil {
+			break
 		}
 	}
 
+	if err != nil && err != io.EOF {
+		return err
+	}
+
 	_, err = d.r.Seek(0, io.SeekStart)
 	return err
 }
 
-func (d *Decoder) parseTrack() (nextChunkType, error) {
-	id, err := d.IDnSize()
-	if err != nil {
-		return trackChunk, err
-	}
-	if id != trackChunkID {
-		return trackChunk, fmt.Errorf("%s - expected track chunk ID %v, got %v", ErrUnexpectedData, trackChunkID, id)
+// parseTrack moves to the next track chunk, chunks of other types are skipped.
+func (d *Decoder) parseTrack() error {
+	for {
+		id, size, err := d.chunkHeader()
+		if err != nil {
+			return err
+		}
+
+		if id == trackChunkID {
+			d.trackEnd = d.offset + int64(size)
+			break
+		}
+
+		d.offset += int64(size)
+		if _, err := d.r.Seek(d.offset, io.SeekStart); err != nil {
+			return err
+		}
 	}
 
 	d.currentTrack = new(Track)
 	d.Tracks = append(d.Tracks, d.currentTrack)
+	d.lastEvent = nil
 
-	return eventChunk, nil
+	return nil
 }
 
-func (d *Decoder) parseEvent() (nextChunkType, error) {
+func (d *Decoder) parseEvent() error {
 
 	timeDelta, err := d.varLen()
 	if err != nil {
-		return eventChunk, err
+		return err
 	}
 
+	d.currentTrack.timeDelta += int64(timeDelta)
+
 	// status byte give us the msg type and channel.
 	statusByte, err := d.readByte()
 	if err != nil {
-		return eventChunk, err
+		return err
 	}
 
-	e := &Event{timeDelta: timeDelta}
+	e := &Event{timeDelta: timeDelta, AbsTicks: d.currentTrack.timeDelta}
 	e.MsgType = (statusByte & 0xF0) >> 4
+	e.Channel = statusByte & 0x0F
 
 	if statusByte&0x80 == 0 {
 		if d.lastEvent != nil && isVoiceMsgType(d.lastEvent.MsgType) {
 			e.MsgType = d.lastEvent.MsgType
+			e.Channel = d.lastEvent.Channel
 
 			d.offset -= 1
 			if _, err := d.r.Seek(-1, io.SeekCurrent); err != nil {
-				return eventChunk, err
+				return err
 			}
 		}
 	}
 
 	if e.MsgType == 0 {
-		return eventChunk, nil
+		return nil
 	}
 
 	d.lastEvent = e
 
-	nextChunk := eventChunk
+	status := e.MsgType<<4 | e.Channel
+	if e.MsgType == 0xF {
+		status = statusByte
+	}
+	start := d.offset
+
+	if err := d.parseData(e, statusByte); err != nil {
+		return err
+	}
+
+	// a data byte without running status is skipped, it cannot be written back
+	if d.KeepMessages && status&0x80 != 0 {
+		return d.keepMessage(e, status, start)
+	}
+
+	return nil
+}
+
+// keepMessage rereads the bytes of the message after the status byte.
+func (d *Decoder) keepMessage(e *Event, status byte, start int64) error {
+	m := &Message{AbsTicks: e.AbsTicks, Status: status, Data: make([]byte, d.offset-start)}
+	if isNoteMsgType(e.MsgType) {
+		m.Event = e
+	}
+
+	if _, err := d.r.Seek(start, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := io.ReadFull(d.r, m.Data); err != nil {
+		return err
+	}
+
+	d.currentTrack.Messages = append(d.currentTrack.Messages, m)
+	return nil
+}
+
+func (d *Decoder) parseData(e *Event, statusByte byte) error {
+	var err error
 
 	// Extract values based on message type
 	switch e.MsgType {
 
 	case 0x2, 0x3, 0x4, 0x5, 0x6, 0xC, 0xD:
 		if _, err := d.r.Seek(1, io.SeekCurrent); err != nil {
-			return eventChunk, err
+			return err
 		}
 		d.offset += 1
 
 	case 0xB, 0xE:
 		if _, err := d.r.Seek(2, io.SeekCurrent); err != nil {
-			return eventChunk, err
+			return err
 		}
 		d.offset += 2
 
 	// Note Off
 	case 0x8:
 		if e.Note, err = d.uint7(); err != nil {
-			return eventChunk, err
+			return err
 		}
 		e.VelocityByteOffset = d.offset
 		if e.Velocity, err = d.uint7(); err != nil {
-			return eventChunk, err
+			return err
 		}
 
-		d.currentTrack.timeDelta += int64(timeDelta)
-		e.absTicks = d.currentTrack.timeDelta
-		e.QuarterPosition = quarterPosition(e.absTicks, int64(d.TicksPerQuarterNote))
+		e.QuarterPosition = quarterPosition(e.AbsTicks, int64(d.TicksPerQuarterNote))
 
 		d.currentTrack.Events = append(d.currentTrack.Events, e)
 
 	// Note On
 	case 0x9:
 		if e.Note, err = d.uint7(); err != nil {
-			return eventChunk, err
+			return err
 		}
 		e.VelocityByteOffset = d.offset
 		if e.Velocity, err = d.uint7(); err != nil {
-			return eventChunk, err
+			return err
 		}
 
-		d.currentTrack.timeDelta += int64(timeDelta)
-		e.absTicks = d.currentTrack.timeDelta
-		e.QuarterPosition = quarterPosition(e.absTicks, int64(d.TicksPerQuarterNote))
+		e.QuarterPosition = quarterPosition(e.AbsTicks, int64(d.TicksPerQuarterNote))
 
 		d.currentTrack.Events = append(d.currentTrack.Events, e)
 
 	// Polyphonic Key Pressure (aftertouch)
 	case 0xA:
 		if e.Note, err = d.uint7(); err != nil {
-			return eventChunk, err
+			return err
 		}
 		e.VelocityByteOffset = d.offset
 		if e.Velocity, err = d.uint7(); err != nil {
-			return eventChunk, err
+			return err
 		}
 
-		d.currentTrack.timeDelta += int64(timeDelta)
-		e.absTicks = d.currentTrack.timeDelta
-		e.QuarterPosition = quarterPosition(e.absTicks, int64(d.TicksPerQuarterNote))
+		e.QuarterPosition = quarterPosition(e.AbsTicks, int64(d.TicksPerQuarterNote))
 
 		d.currentTrack.Events = append(d.currentTrack.Events, e)
 
+	// Meta and System Exclusive messages are not added to the track
 	case 0xF:
-		var ok bool
-		nextChunk, ok, err = d.parseMetaMsg()
-		// early exit without adding the event to the track
-		if err != nil || !ok {
-			return nextChunk, err
+		if statusByte == 0xFF {
+			return d.parseMetaMsg(e)
 		}
+		return d.varLenTxt()
 
 	default:
-		return eventChunk, nil
+		return nil
 	}
 
-	return nextChunk, err
+	return nil
 }
 
-func (p *Decoder) parseMetaMsg() (nextChunkType, bool, error) {
-	if _, err := p.readByte(); err != nil {
-		return eventChunk, false, err
+func (d *Decoder) parseMetaMsg(e *Event) error {
+	metaType, err := d.readByte()
+	if err != nil {
+		return err
 	}
 
-	err := p.varLenTxt()
-	if err != nil {
-		return eventChunk, false, err
+	switch metaType {
+	// Sequence/Track Name
+	case 0x03:
+		data, err := d.varLenData()
+		if err != nil {
+			return err
+		}
+		d.currentTrack.Name = string(data)
+
+	// Set Tempo
+	case 0x51:
+		data, err := d.varLenData()
+		if err != nil {
+			return err
+		}
+		if len(data) != 3 {
+			return fmt.Errorf("%s - expected tempo of 3 bytes, got %d", ErrUnexpectedData, len(data))
+		}
+		d.Tempos = append(d.Tempos, Tempo{
+			AbsTicks:               e.AbsTicks,
+			MicrosecondsPerQuarter: uint32(data[0])<<16 | uint32(data[1])<<8 | uint32(data[2]),
+		})
+
+	// Time Signature
+	case 0x58:
+		data, err := d.varLenData()
+		if err != nil {
+			return err
+		}
+		if len(data) != 4 {
+			return fmt.Errorf("%s - expected time signature of 4 bytes, got %d", ErrUnexpectedData, len(data))
+		}
+		// a denominator above a 128th note does not fit
+		if data[1] > 7 {
+			return fmt.Errorf("%s - time signature denominator 2^%d", ErrUnexpectedData, data[1])
+		}
+		d.TimeSignatures = append(d.TimeSignatures, TimeSignature{
+			AbsTicks:    e.AbsTicks,
+			Numerator:   data[0],
+			Denominator: 1 << data[1],
+		})
+
+	default:
+		return d.varLenTxt()
 	}
-	return eventChunk, true, nil
+
+	return nil
 }
 
 func NewDecoder(r io.ReadSeeker) *Decoder {
 	return &Decoder{r: r, offset: 0}
 }
+
+// Offset returns the byte offset the decoder has reached, which after a failed
+// Decode points at the data that could not be parsed.
+func (d *Decoder) Offset() int64 {
+	return d.offset
+}
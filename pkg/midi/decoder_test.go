@@ -77,7 +77,10 @@ func TestDecoder_Decode(t *testing.T) {
 	err = decoder.Decode()
 	require.NoError(t, err)
 
-	events := decoder.Tracks[0].Events
+	require.Equal(t, 2, len(decoder.Tracks))
+	assert.Equal(t, 0, len(decoder.Tracks[0].Events))
+
+	events := decoder.Tracks[1].Events
 
 	assert.Equal(t, 2, len(events))
 
@@ -124,3 +127,69 @@ func TestDecodeQuarter(t *testing.T) {
 		}
 	}
 }
+
+func TestDecoder_Meta(t *testing.T) {
+	f, err := os.Open("./test2.mid")
+	require.NoError(t, err)
+
+	defer f.Close()
+
+	decoder := NewDecoder(f)
+	err = decoder.Decode()
+	require.NoError(t, err)
+
+	assert.Equal(t, []Tempo{{AbsTicks: 0, MicrosecondsPerQuarter: 500000}}, decoder.Tempos)
+	assert.Equal(t, 120.0, decoder.Tempos[0].BPM())
+	assert.Equal(t, []TimeSignature{{AbsTicks: 0, Numerator: 4, Denominator: 4}}, decoder.TimeSignatures)
+
+	assert.Equal(t, "", decoder.Tracks[0].Name)
+	assert.Equal(t, "Drumkit", decoder.Tracks[1].Name)
+
+	for _, event := range decoder.Tracks[1].Events {
+		assert.Equal(t, uint8(9), event.Channel)
+	}
+}
+
+func TestDecoder_Offset(t *testing.T) {
+	data, err := ioutil.ReadFile("./test.mid")
+	require.NoError(t, err)
+
+	data[7] = 7 // header size
+
+	decoder := NewDecoder(bytes.NewReader(data))
+	err = decoder.Decode()
+	require.Error(t, err)
+	assert.Equal(t, int64(4), decoder.Offset())
+}
+
+func TestDecoder_Truncated(t *testing.T) {
+	data, err := ioutil.ReadFile("./test.mid")
+	require.NoError(t, err)
+
+	decoder := NewDecoder(bytes.NewReader(data[:len(data)-10]))
+	err = decoder.Decode()
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+	assert.NotEmpty(t, decoder.Tracks)
+}
+
+func TestDecoder_TimeSignatureDenominator(t *testing.T) {
+	data, err := ioutil.ReadFile("./test2.mid")
+	require.NoError(t, err)
+
+	i := bytes.Index(data, []byte{0xFF, 0x58, 0x04})
+	require.True(t, i >= 0)
+
+	for exponent, ok := range map[byte]bool{7: true, 8: false, 255: false} {
+		data[i+4] = exponent
+
+		decoder := NewDecoder(bytes.NewReader(data))
+		err = decoder.Decode()
+		if ok {
+			require.NoError(t, err)
+			assert.Equal(t, uint8(128), decoder.TimeSignatures[0].Denominator)
+			continue
+		}
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), ErrUnexpectedData.Error())
+	}
+}
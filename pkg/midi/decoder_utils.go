@@ -51,19 +51,41 @@ func (d *Decoder) varLenTxt() error {
 	return err
 }
 
+// varLenData reads a variable length value and as many bytes as it says.
+func (d *Decoder) varLenData() ([]byte, error) {
+	l, err := d.varLen()
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, l)
+	if _, err = io.ReadFull(d.r, data); err != nil {
+		return nil, err
+	}
+	d.offset += int64(l)
+
+	return data, nil
+}
+
 func (d *Decoder) IDnSize() ([4]byte, error) {
+	ID, _, err := d.chunkHeader()
+	return ID, err
+}
+
+func (d *Decoder) chunkHeader() ([4]byte, uint32, error) {
 	var ID [4]byte
 	if err := binary.Read(d.r, binary.BigEndian, &ID); err != nil {
-		return ID, err
+		return ID, 0, err
 	}
 	d.offset += 4 // [4]byte ID
 
-	if _, err := d.r.Seek(4, io.SeekCurrent); err != nil {
-		return ID, err
+	var size uint32
+	if err := binary.Read(d.r, binary.BigEndian, &size); err != nil {
+		return ID, 0, err
 	}
 	d.offset += 4 // uint32 blockSize
 
-	return ID, nil
+	return ID, size, nil
 }
 
 func quarterPosition(absTicks int64, ticksPerQuarterNote int64) int {
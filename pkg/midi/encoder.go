@@ -0,0 +1,124 @@
+package midi
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sort"
+)
+
+// ErrNoMessages reports a track decoded without Decoder.KeepMessages.
+var ErrNoMessages = errors.New("track has no messages, decode with KeepMessages")
+
+const endOfTrack = 0x2F
+
+// Encoder writes Standard MIDI Files from decoded tracks.
+type Encoder struct {
+	w io.Writer
+}
+
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+// Encode writes the tracks with the header of the decoder. The messages of a
+// track are written in the order of their ticks, messages on the same tick
+// keep their order, and the End of Track comes last even if an event was
+// moved past it. Running status is not used.
+func (e *Encoder) Encode(d *Decoder) error {
+	w := bufio.NewWriter(e.w)
+
+	if _, err := w.Write(headerChunkID[:]); err != nil {
+		return err
+	}
+	header := []uint16{d.Format, uint16(len(d.Tracks)), d.Division}
+	if err := binary.Write(w, binary.BigEndian, uint32(6)); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.BigEndian, header); err != nil {
+		return err
+	}
+
+	for _, track := range d.Tracks {
+		data, err := encodeTrack(track)
+		if err != nil {
+			return err
+		}
+
+		if _, err := w.Write(trackChunkID[:]); err != nil {
+			return err
+		}
+		if err := binary.Write(w, binary.BigEndian, uint32(len(data))); err != nil {
+			return err
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+
+	return w.Flush()
+}
+
+func isEndOfTrack(m *Message) bool {
+	return m.Status == 0xFF && len(m.Data) > 0 && m.Data[0] == endOfTrack
+}
+
+func (m *Message) ticks() int64 {
+	if m.Event != nil {
+		return m.Event.AbsTicks
+	}
+	return m.AbsTicks
+}
+
+func (m *Message) bytes() []byte {
+	if m.Event != nil {
+		return []byte{m.Event.MsgType<<4 | m.Event.Channel, m.Event.Note & 0x7F, m.Event.Velocity & 0x7F}
+	}
+	return append([]byte{m.Status}, m.Data...)
+}
+
+func encodeTrack(track *Track) ([]byte, error) {
+	if len(track.Messages) == 0 && len(track.Events) > 0 {
+		return nil, ErrNoMessages
+	}
+
+	messages := make([]*Message, 0, len(track.Messages))
+	end := int64(0)
+	for _, m := range track.Messages {
+		if isEndOfTrack(m) {
+			if m.AbsTicks > end {
+				end = m.AbsTicks
+			}
+			continue
+		}
+		messages = append(messages, m)
+	}
+	sort.SliceStable(messages, func(i, j int) bool { return messages[i].ticks() < messages[j].ticks() })
+
+	var (
+		data []byte
+		last int64
+	)
+	for _, m := range messages {
+		ticks := m.ticks()
+		if ticks < 0 {
+			ticks = 0
+		}
+		if ticks < last {
+			ticks = last
+		}
+
+		data = append(data, encodeVarint(uint32(ticks-last))...)
+		data = append(data, m.bytes()...)
+		last = ticks
+	}
+
+	if end < last {
+		end = last
+	}
+	data = append(data, encodeVarint(uint32(end-last))...)
+	data = append(data, 0xFF, endOfTrack, 0)
+
+	return data, nil
+}
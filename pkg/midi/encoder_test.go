@@ -0,0 +1,122 @@
+package midi
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"testing"
+)
+
+func decodeBytes(t *testing.T, data []byte) *Decoder {
+	decoder := NewDecoder(bytes.NewReader(data))
+	decoder.KeepMessages = true
+	require.NoError(t, decoder.Decode())
+	return decoder
+}
+
+func encodeBytes(t *testing.T, decoder *Decoder) []byte {
+	var buf bytes.Buffer
+	require.NoError(t, NewEncoder(&buf).Encode(decoder))
+	return buf.Bytes()
+}
+
+type noteEvent struct {
+	AbsTicks int64
+	MsgType  uint8
+	Channel  uint8
+	Note     uint8
+	Velocity uint8
+}
+
+func noteEvents(decoder *Decoder) [][]noteEvent {
+	var tracks [][]noteEvent
+	for _, track := range decoder.Tracks {
+		var events []noteEvent
+		for _, e := range track.Events {
+			events = append(events, noteEvent{e.AbsTicks, e.MsgType, e.Channel, e.Note, e.Velocity})
+		}
+		tracks = append(tracks, events)
+	}
+	return tracks
+}
+
+func TestEncoder_Encode(t *testing.T) {
+	for _, name := range []string{"./test.mid", "./test2.mid"} {
+		data, err := ioutil.ReadFile(name)
+		require.NoError(t, err)
+
+		decoder := decodeBytes(t, data)
+		encoded := decodeBytes(t, encodeBytes(t, decoder))
+
+		assert.Equal(t, decoder.Format, encoded.Format, name)
+		assert.Equal(t, decoder.Division, encoded.Division, name)
+		assert.Equal(t, noteEvents(decoder), noteEvents(encoded), name)
+		assert.Equal(t, decoder.Tempos, encoded.Tempos, name)
+		assert.Equal(t, decoder.TimeSignatures, encoded.TimeSignatures, name)
+		for i := range decoder.Tracks {
+			assert.Equal(t, decoder.Tracks[i].Name, encoded.Tracks[i].Name, name)
+			assert.Equal(t, len(decoder.Tracks[i].Messages), len(encoded.Tracks[i].Messages), name)
+		}
+	}
+}
+
+func TestEncoder_Moved(t *testing.T) {
+	data, err := ioutil.ReadFile("./test.mid")
+	require.NoError(t, err)
+
+	decoder := decodeBytes(t, data)
+	notes := decoder.Tracks[1].Notes()
+	require.NotEmpty(t, notes)
+
+	// past the End of Track of the input
+	last := notes[len(notes)-1]
+	last.Off.AbsTicks += 10000
+
+	encoded := decodeBytes(t, encodeBytes(t, decoder))
+	events := encoded.Tracks[1].Events
+	assert.Equal(t, last.Off.AbsTicks, events[len(events)-1].AbsTicks)
+
+	messages := encoded.Tracks[1].Messages
+	assert.True(t, isEndOfTrack(messages[len(messages)-1]))
+	assert.Equal(t, last.Off.AbsTicks, messages[len(messages)-1].AbsTicks)
+}
+
+func TestEncoder_NoMessages(t *testing.T) {
+	data, err := ioutil.ReadFile("./test.mid")
+	require.NoError(t, err)
+
+	decoder := NewDecoder(bytes.NewReader(data))
+	require.NoError(t, decoder.Decode())
+	assert.Equal(t, ErrNoMessages, NewEncoder(ioutil.Discard).Encode(decoder))
+}
+
+func TestTrack_Notes(t *testing.T) {
+	on := func(ticks int64, note uint8) *Event {
+		return &Event{AbsTicks: ticks, MsgType: 0x9, Note: note, Velocity: 100}
+	}
+	off := func(ticks int64, note uint8) *Event {
+		return &Event{AbsTicks: ticks, MsgType: 0x8, Note: note}
+	}
+
+	track := &Track{Events: []*Event{
+		on(0, 36), on(0, 42), off(10, 42), on(20, 36), off(30, 36), off(40, 36), on(50, 38),
+	}}
+	track.Events[5].MsgType, track.Events[5].Velocity = 0x9, 0 // Note On with velocity 0
+
+	notes := track.Notes()
+	require.Len(t, notes, 4)
+	assert.Equal(t, int64(30), notes[0].Off.AbsTicks)
+	assert.Equal(t, int64(10), notes[1].Off.AbsTicks)
+	assert.Equal(t, int64(40), notes[2].Off.AbsTicks)
+	assert.Nil(t, notes[3].Off)
+}
+
+func TestEncodeVarint(t *testing.T) {
+	for _, x := range []uint32{0, 1, 127, 128, 8192, 16383, 16384, 0x0FFFFFFF} {
+		v, n := decodeVarint(encodeVarint(x))
+		assert.Equal(t, x, v)
+		assert.Equal(t, len(encodeVarint(x)), n)
+	}
+	assert.Equal(t, []byte{0x81, 0x00}, encodeVarint(128))
+}
@@ -0,0 +1,29 @@
+package midi
+
+import "math"
+
+// gridDivisions are the lines per quarter note of the 1/16 and of the 1/16
+// triplet grid.
+var gridDivisions = []float64{4, 6}
+
+// GridLine returns the tick of the line of the 1/16 or the 1/16 triplet grid
+// nearest to ticks.
+func GridLine(ticks int64, ticksPerQuarterNote uint16) int64 {
+	best, bestDistance := ticks, math.MaxFloat64
+
+	for _, division := range gridDivisions {
+		step := float64(ticksPerQuarterNote) / division
+		line := math.Round(float64(ticks)/step) * step
+		if d := math.Abs(float64(ticks) - line); d < bestDistance {
+			best, bestDistance = int64(math.Round(line)), d
+		}
+	}
+
+	return best
+}
+
+// QuarterPosition returns the quarter note of the bar ticks fall on, as
+// Event.QuarterPosition.
+func QuarterPosition(ticks int64, ticksPerQuarterNote uint16) int {
+	return quarterPosition(ticks, int64(ticksPerQuarterNote))
+}
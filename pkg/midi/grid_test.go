@@ -0,0 +1,16 @@
+package midi
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestGridLine(t *testing.T) {
+	for _, c := range []struct {
+		ticks, line int64
+	}{
+		{0, 0}, {5, 0}, {-5, 0}, {115, 120}, {155, 160}, {470, 480}, {1010, 1040},
+	} {
+		assert.Equal(t, c.line, GridLine(c.ticks, 480), "%d", c.ticks)
+	}
+}
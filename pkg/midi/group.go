@@ -0,0 +1,31 @@
+package midi
+
+// Simultaneous groups the hits, Note On events with a velocity, that start
+// within window ticks of the first hit of their group. The events are in the
+// order of their ticks, groups of a single hit are left out.
+func Simultaneous(events []*Event, window int64) [][]*Event {
+	var (
+		groups [][]*Event
+		group  []*Event
+	)
+
+	flush := func() {
+		if len(group) > 1 {
+			groups = append(groups, group)
+		}
+		group = nil
+	}
+
+	for _, e := range events {
+		if e.MsgType != 0x9 || e.Velocity == 0 {
+			continue
+		}
+		if len(group) > 0 && e.AbsTicks-group[0].AbsTicks > window {
+			flush()
+		}
+		group = append(group, e)
+	}
+	flush()
+
+	return groups
+}
@@ -0,0 +1,20 @@
+package midi
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSimultaneous(t *testing.T) {
+	kick := &Event{AbsTicks: 0, MsgType: 0x9, Note: 36, Velocity: 100}
+	crash := &Event{AbsTicks: 3, MsgType: 0x9, Note: 49, Velocity: 110}
+	kickOff := &Event{AbsTicks: 5, MsgType: 0x8, Note: 36}
+	grace := &Event{AbsTicks: 460, MsgType: 0x9, Note: 38, Velocity: 40}
+	snare := &Event{AbsTicks: 480, MsgType: 0x9, Note: 38, Velocity: 110}
+	late := &Event{AbsTicks: 490, MsgType: 0x9, Note: 42, Velocity: 80}
+	alone := &Event{AbsTicks: 960, MsgType: 0x9, Note: 42, Velocity: 80}
+
+	groups := Simultaneous([]*Event{kick, crash, kickOff, grace, snare, late, alone}, 20)
+
+	assert.Equal(t, [][]*Event{{kick, crash}, {grace, snare}}, groups)
+}
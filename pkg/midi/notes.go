@@ -0,0 +1,40 @@
+package midi
+
+// Note is a Note On event and the event that ends it, a Note Off or a Note
+// On with velocity 0. Off is nil when the track never ends the note.
+type Note struct {
+	On  *Event
+	Off *Event
+}
+
+// Notes pairs the Note On events of the track with the events that end
+// them, in the order of the Note On events. Overlapping notes of the same
+// key are ended first in, first out.
+func (t *Track) Notes() []*Note {
+	type key struct {
+		channel uint8
+		note    uint8
+	}
+
+	var notes []*Note
+	playing := make(map[key][]*Note)
+
+	for _, e := range t.Events {
+		k := key{e.Channel, e.Note}
+
+		switch {
+		case e.MsgType == 0x9 && e.Velocity > 0:
+			n := &Note{On: e}
+			notes = append(notes, n)
+			playing[k] = append(playing[k], n)
+
+		case e.MsgType == 0x8 || e.MsgType == 0x9:
+			if open := playing[k]; len(open) > 0 {
+				open[0].Off = e
+				playing[k] = open[1:]
+			}
+		}
+	}
+
+	return notes
+}
@@ -25,3 +25,17 @@ func decodeVarint(buf []byte) (x uint32, n int) {
 func isVoiceMsgType(b byte) bool {
 	return 0x8 <= b && b <= 0xE
 }
+
+// isNoteMsgType reports whether the message type carries a note and a
+// velocity: Note Off, Note On and polyphonic aftertouch.
+func isNoteMsgType(b byte) bool {
+	return 0x8 <= b && b <= 0xA
+}
+
+func encodeVarint(x uint32) []byte {
+	buf := []byte{byte(x & 0x7F)}
+	for x >>= 7; x > 0; x >>= 7 {
+		buf = append([]byte{byte(x&0x7F) | 0x80}, buf...)
+	}
+	return buf
+}
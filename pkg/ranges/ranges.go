@@ -0,0 +1,70 @@
+package ranges
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Range is an inclusive range of integers.
+type Range struct {
+	Min int
+	Max int
+}
+
+// List is a set of integers written as "1,3-5,10", an empty List contains nothing.
+type List []Range
+
+// Parse parses a comma separated list of numbers and ranges like "35-51,57".
+func Parse(s string) (List, error) {
+	var list List
+
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		var (
+			r   Range
+			err error
+		)
+
+		if i := strings.Index(part[1:], "-"); i >= 0 {
+			i++ // the first character may be a minus sign
+			if r.Min, err = strconv.Atoi(strings.TrimSpace(part[:i])); err != nil {
+				return nil, fmt.Errorf("bad range %q", part)
+			}
+			if r.Max, err = strconv.Atoi(strings.TrimSpace(part[i+1:])); err != nil {
+				return nil, fmt.Errorf("bad range %q", part)
+			}
+			if r.Min > r.Max {
+				return nil, fmt.Errorf("bad range %q, %d > %d", part, r.Min, r.Max)
+			}
+		} else {
+			if r.Min, err = strconv.Atoi(part); err != nil {
+				return nil, fmt.Errorf("bad number %q", part)
+			}
+			r.Max = r.Min
+		}
+
+		list = append(list, r)
+	}
+
+	return list, nil
+}
+
+func (l List) Contains(v int) bool {
+	for _, r := range l {
+		if v >= r.Min && v <= r.Max {
+			return true
+		}
+	}
+	return false
+}
+
+// Empty reports whether the list selects nothing, which callers usually
+// treat as "no restriction".
+func (l List) Empty() bool {
+	return len(l) == 0
+}
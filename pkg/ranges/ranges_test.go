@@ -0,0 +1,31 @@
+package ranges
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	l, err := Parse("35-51, 57,-3--1")
+	require.NoError(t, err)
+
+	assert.Equal(t, List{{35, 51}, {57, 57}, {-3, -1}}, l)
+
+	assert.True(t, l.Contains(35))
+	assert.True(t, l.Contains(51))
+	assert.True(t, l.Contains(57))
+	assert.True(t, l.Contains(-2))
+	assert.False(t, l.Contains(52))
+	assert.False(t, l.Contains(0))
+
+	l, err = Parse("")
+	require.NoError(t, err)
+	assert.True(t, l.Empty())
+
+	_, err = Parse("10-5")
+	assert.Error(t, err)
+
+	_, err = Parse("a")
+	assert.Error(t, err)
+}
@@ -0,0 +1,147 @@
+package sticking
+
+import (
+	"github.com/Garik-/humanize/pkg/drummap"
+	"math"
+	"sort"
+)
+
+// Hand is the hand a hit is played with.
+type Hand int
+
+const (
+	None  Hand = -1 // the hit is not part of a run
+	Lead  Hand = 0  // the hand that plays the hits on the beat, every hit of a run played by one hand
+	Other Hand = 1  // the hand between the hits of the lead hand
+)
+
+func (h Hand) String() string {
+	switch h {
+	case Lead:
+		return "lead"
+	case Other:
+		return "other"
+	}
+	return "none"
+}
+
+// Families are the instruments whose repeated hits are played with a
+// sticking.
+var Families = []string{"hihat", "ride"}
+
+// MinHits is the number of hits a run needs.
+const MinHits = 4
+
+// divisions are the grids runs are played on, in lines per quarter note.
+// Eighths and eighth triplets are played with the lead hand alone, anything
+// faster alternates.
+var divisions = []int{2, 3, 4, 6, 8}
+
+const alternatingDivision = 4
+
+// Run is a pattern of repeated hits of one instrument.
+type Run struct {
+	Start       int  // the index of the first hit
+	End         int  // the index after the last hit
+	Division    int  // the grid lines per quarter note the hits are on
+	Alternating bool // the hands alternate, otherwise the lead hand plays every hit
+}
+
+// Runs finds the runs in the ticks of the hits of one instrument, which are in
+// ascending order. Hits at most an eighth note apart belong to the same run.
+func Runs(ticks []int64, ticksPerQuarterNote uint16) []Run {
+	var runs []Run
+
+	maxGap := int64(ticksPerQuarterNote) * 5 / 8 // an eighth note and some play
+	start := 0
+	for i := 1; i <= len(ticks); i++ {
+		if i < len(ticks) && ticks[i]-ticks[i-1] <= maxGap {
+			continue
+		}
+
+		if i-start >= MinHits {
+			if r, ok := newRun(ticks, start, i, ticksPerQuarterNote); ok {
+				runs = append(runs, r)
+			}
+		}
+		start = i
+	}
+
+	return runs
+}
+
+// newRun puts the hits on the grid their median distance is closest to.
+func newRun(ticks []int64, start int, end int, ticksPerQuarterNote uint16) (Run, bool) {
+	var intervals []int64
+	for i := start + 1; i < end; i++ {
+		// hits on the same tick are played together
+		if d := ticks[i] - ticks[i-1]; d > 0 {
+			intervals = append(intervals, d)
+		}
+	}
+	if len(intervals) == 0 {
+		return Run{}, false
+	}
+	sort.Slice(intervals, func(i, j int) bool { return intervals[i] < intervals[j] })
+	median := float64(intervals[len(intervals)/2])
+
+	division, distance := 0, math.MaxFloat64
+	for _, d := range divisions {
+		step := float64(ticksPerQuarterNote) / float64(d)
+		if dist := math.Abs(step - median); dist < distance {
+			division, distance = d, dist
+		}
+	}
+
+	return Run{Start: start, End: end, Division: division, Alternating: division >= alternatingDivision}, true
+}
+
+// Hand returns the hand of a hit of the run. The lead hand of an alternating
+// run plays the even lines of its grid, the ones on the eighths of a run of
+// sixteenths.
+func (r Run) Hand(ticks int64, ticksPerQuarterNote uint16) Hand {
+	if !r.Alternating {
+		return Lead
+	}
+	line := int64(math.Round(float64(ticks) * float64(r.Division) / float64(ticksPerQuarterNote)))
+	if line%2 == 0 {
+		return Lead
+	}
+	return Other
+}
+
+// Hands returns the hand of each hit of one instrument, None for the hits
+// outside runs.
+func Hands(ticks []int64, ticksPerQuarterNote uint16) []Hand {
+	hands := make([]Hand, len(ticks))
+	for i := range hands {
+		hands[i] = None
+	}
+
+	for _, r := range Runs(ticks, ticksPerQuarterNote) {
+		for i := r.Start; i < r.End; i++ {
+			hands[i] = r.Hand(ticks[i], ticksPerQuarterNote)
+		}
+	}
+	return hands
+}
+
+// Feet are the articulations of those families played with a foot, they are
+// not part of the runs of the hands.
+var Feet = []drummap.Articulation{drummap.HihatPedal}
+
+// Played reports whether the articulation is played with a sticking, by a
+// hand of a family that has one.
+func Played(a drummap.Articulation) bool {
+	for _, foot := range Feet {
+		if a.Within(foot) {
+			return false
+		}
+	}
+	for _, f := range Families {
+		if f == a.Family() {
+			return true
+		}
+	}
+	return false
+}
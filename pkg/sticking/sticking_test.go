@@ -0,0 +1,41 @@
+package sticking
+
+import (
+	"github.com/Garik-/humanize/pkg/drummap"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestRuns(t *testing.T) {
+	// a bar of played sixteenths, a gap and three eighths, too few for a run
+	ticks := []int64{0, 118, 242, 361, 480, 600, 719, 843, 1920, 2160, 2400}
+
+	runs := Runs(ticks, 480)
+
+	assert.Equal(t, []Run{{Start: 0, End: 8, Division: 4, Alternating: true}}, runs)
+}
+
+func TestRuns_Eighths(t *testing.T) {
+	ticks := []int64{0, 240, 480, 480, 720, 960}
+
+	runs := Runs(ticks, 480)
+
+	assert.Equal(t, []Run{{Start: 0, End: 6, Division: 2}}, runs)
+}
+
+func TestHands(t *testing.T) {
+	ticks := []int64{0, 118, 242, 361, 480, 2000}
+
+	hands := Hands(ticks, 480)
+
+	assert.Equal(t, []Hand{Lead, Other, Lead, Other, Lead, None}, hands)
+}
+
+func TestPlayed(t *testing.T) {
+	assert.True(t, Played(drummap.RideTip))
+	assert.True(t, Played(drummap.HihatClosedEdge))
+	assert.True(t, Played(drummap.HihatOpen))
+	assert.False(t, Played(drummap.HihatPedal))
+	assert.False(t, Played(drummap.SnareCenter))
+	assert.False(t, Played(""))
+}